@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"sns-login/logger"
+	"sns-login/oidc"
+)
+
+const appleProviderName = "apple"
+
+func newAppleProvider() (Provider, error) {
+	if os.Getenv("APPLE_CLIENT_ID") == "" {
+		return Provider{}, errProviderNotConfigured
+	}
+	client, err := oidc.NewAppleOidcClient()
+	if err != nil {
+		return Provider{}, err
+	}
+
+	return Provider{
+		Name:        appleProviderName,
+		DisplayName: "Apple",
+		Client:      client,
+		Scopes:      []string{"openid", "name", "email"},
+		// nameとemailを要求する場合、Appleはform_postでしか認可レスポンスを返さない。
+		// form_postはappleid.apple.comからのクロスサイトのPOSTになるので、cookieはSameSite=Noneにする
+		SameSite: http.SameSiteNoneMode,
+		AuthOptions: func(_ *http.Request) []oidc.AuthOption {
+			return []oidc.AuthOption{oidc.WithResponseMode("form_post")}
+		},
+		AfterLogin: appleAfterLogin,
+	}, nil
+}
+
+// appleAfterLogin はAppleが初回の認可時にだけフォームのuserパラメータで送ってくる名前をIdentityに入れる
+func appleAfterLogin(_ http.ResponseWriter, r *http.Request, identity *oidc.Identity) bool {
+	appleUser, err := oidc.ParseAppleUser(r.PostFormValue("user"))
+	if err != nil {
+		// 名前が取れなくてもログインはできるので、ログに出力して続ける
+		l := logger.New(false)
+		l.Logger.Error().Err(err).Msg("failed to parse apple user")
+
+		return true
+	}
+	if identity.Name == "" {
+		identity.Name = appleUser.FullName()
+	}
+
+	return true
+}
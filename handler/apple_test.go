@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sns-login/oidc"
+	"sns-login/session"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLoginClient struct {
+	identity oidc.Identity
+	code     string
+	verifier string
+	nonce    string
+}
+
+func (c *fakeLoginClient) AuthUrl(_ string, _ []string, _ string, _ string, _ ...oidc.AuthOption) string {
+	return "https://idp.example.com/auth"
+}
+
+func (c *fakeLoginClient) Exchange(_ context.Context, code, _, codeVerifier, nonce string) (oidc.Identity, error) {
+	c.code = code
+	c.verifier = codeVerifier
+	c.nonce = nonce
+
+	return c.identity, nil
+}
+
+func setAppleEnv(t *testing.T) func() {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "AuthKey.p8")
+	bPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: bKey})
+	if err := ioutil.WriteFile(keyPath, bPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"APPLE_CLIENT_ID":        "com.example.service",
+		"APPLE_TEAM_ID":          "TEAMID1234",
+		"APPLE_KEY_ID":           "KEYID12345",
+		"APPLE_PRIVATE_KEY_PATH": keyPath,
+	}
+	for k, v := range env {
+		_ = os.Setenv(k, v)
+	}
+
+	return func() {
+		for k := range env {
+			_ = os.Unsetenv(k)
+		}
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestLoginHandler_Apple(t *testing.T) {
+	defer setAppleEnv(t)()
+
+	provider, err := newAppleProvider()
+	assert.Nil(t, err)
+	router := newTestRouter(t, provider)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/auth/apple/login", nil)
+	router.ServeHTTP(w, r)
+
+	resp := w.Result()
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(resp.Body)
+
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	location, err := resp.Location()
+	assert.Nil(t, err)
+	assert.Equal(t, "appleid.apple.com", location.Host)
+	assert.Equal(t, "form_post", location.Query().Get("response_mode"))
+
+	// form_postはクロスサイトのPOSTなので、cookieはSameSite=NoneかつSecureでないと送られない
+	assert.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, http.SameSiteNoneMode, resp.Cookies()[0].SameSite)
+	assert.True(t, resp.Cookies()[0].Secure)
+}
+
+func TestNewAppleProvider_ConfigMissing(t *testing.T) {
+	_, err := newAppleProvider()
+	assert.ErrorIs(t, err, errProviderNotConfigured)
+
+	// client idだけ設定されていて鍵がない場合は設定の誤りとしてエラーにする
+	_ = os.Setenv("APPLE_CLIENT_ID", "com.example.service")
+	defer func() { _ = os.Unsetenv("APPLE_CLIENT_ID") }()
+	_, err = newAppleProvider()
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, errProviderNotConfigured))
+}
+
+func TestAppleAfterLogin(t *testing.T) {
+	form := url.Values{}
+	form.Set("user", `{"name": {"firstName": "Jane", "lastName": "Doe"}}`)
+	r := httptest.NewRequest(http.MethodPost, "/auth/apple/callback", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	identity := oidc.Identity{}
+	assert.True(t, appleAfterLogin(httptest.NewRecorder(), r, &identity))
+	assert.Equal(t, "Jane Doe", identity.Name)
+}
+
+func TestCompleteLogin_FormPost(t *testing.T) {
+	patterns := []struct {
+		desc          string
+		isExpectValid bool
+		isOtherState  bool
+		provider      string
+	}{
+		{"stateが一致", true, false, "apple"},
+		{"stateが一致しない", false, true, "apple"},
+		{"別のIdPで発行したstate", false, false, "google"},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			db := newTestDb(t)
+			txs := session.NewTransactionStore(db)
+			client := &fakeLoginClient{identity: oidc.Identity{Subject: "001.abc"}}
+			provider := Provider{Name: "apple", Client: client, SameSite: http.SameSiteNoneMode}
+			state, cookie, tx := beginLogin(t, txs, Provider{Name: pattern.provider})
+			if pattern.isOtherState {
+				state = "other"
+			}
+
+			form := url.Values{}
+			form.Set("code", "code-value")
+			form.Set("state", state)
+			r := httptest.NewRequest(http.MethodPost, "/auth/apple/callback", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(cookie)
+
+			w := httptest.NewRecorder()
+			identity, _, ok := completeLogin(w, r, txs, provider)
+			assert.Equal(t, pattern.isExpectValid, ok)
+			if pattern.isExpectValid {
+				assert.Equal(t, "001.abc", identity.Subject)
+				assert.Equal(t, "code-value", client.code)
+				assert.Equal(t, tx.CodeVerifier, client.verifier)
+				assert.Equal(t, tx.Nonce, client.nonce)
+			} else {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				assert.Equal(t, "", client.code)
+			}
+		})
+	}
+}
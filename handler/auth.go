@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sns-login/logger"
+	"sns-login/model"
+	"sns-login/oidc"
+	"sns-login/session"
+)
+
+// loginClient は認可リクエストのURLを作り、認可コードからユーザーの情報を得るクライアント
+type loginClient interface {
+	AuthUrl(respType string, scopes []string, redirectUrl string, state string, opts ...oidc.AuthOption) string
+	Exchange(ctx context.Context, code, redirectUrl, codeVerifier, nonce string) (oidc.Identity, error)
+}
+
+// callbackUrl はIdPからリダイレクトされて戻ってくるURLを返す
+func callbackUrl(path string) string {
+	return fmt.Sprintf(
+		"%s://%s:%s%s",
+		os.Getenv("SERVER_PROTO"),
+		os.Getenv("SERVER_HOST"),
+		os.Getenv("SERVER_PORT"),
+		path,
+	)
+}
+
+// redirectToIdp はログインの試行を保存し、ユーザーをIdPのログイン画面にリダイレクトする
+//
+// returnToはsanitizeReturnToで確認済みの、ログイン後にリダイレクトするパス
+// stateでCSRFを、nonceでid_tokenのリプレイを、PKCEのcode_verifierで認可コードの横取りを防ぐ
+func redirectToIdp(
+	w http.ResponseWriter,
+	r *http.Request,
+	txs *session.TransactionStore,
+	provider Provider,
+	returnTo string,
+	opts ...oidc.AuthOption,
+) {
+	l := logger.New(false)
+
+	tx, state, err := txs.Begin(w, provider.Name, returnTo, provider.SameSite)
+	if err != nil {
+		l.Logger.Error().Err(err).Msg("failed to begin auth transaction")
+		http.Error(w, "ログインを開始できませんでした。もう一度お試しください。", http.StatusInternalServerError)
+
+		return
+	}
+
+	authOptions := append([]oidc.AuthOption{
+		oidc.WithCodeChallenge(oidc.CodeChallengeS256(tx.CodeVerifier)),
+		oidc.WithNonce(tx.Nonce),
+	}, opts...)
+
+	redirectUrl := provider.Client.AuthUrl(
+		"code",
+		provider.Scopes,
+		callbackUrl(provider.CallbackPath()),
+		state,
+		authOptions...,
+	)
+	// 301はブラウザにキャッシュされ、次のログインで同じstateのURLに飛ばされてしまうので303を使う
+	http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
+}
+
+// completeLogin はstateに対応するログインの試行を取り出してから認可コードをトークンに交換し、検証済みのユーザーの情報を返す
+//
+// クエリ(GET)とフォーム(form_postのPOST)のどちらで戻ってきても扱える。失敗した場合はレスポンスを書き込んでfalseを返す
+func completeLogin(
+	w http.ResponseWriter,
+	r *http.Request,
+	txs *session.TransactionStore,
+	provider Provider,
+) (oidc.Identity, model.AuthTransaction, bool) {
+	l := logger.New(false)
+
+	// ログインを始めたブラウザで、期限内に戻ってきたかを確認してCSRF攻撃を防ぐ
+	tx, err := txs.Complete(w, r, r.FormValue("state"), provider.Name, provider.SameSite)
+	if err != nil {
+		l.Logger.Error().Err(err).Msg("failed to complete auth transaction")
+		if errors.Is(err, session.ErrTransactionNotFound) || errors.Is(err, session.ErrTransactionExpired) {
+			http.Error(w, "ログインの有効期限が切れました。もう一度ログインしてください。", http.StatusBadRequest)
+		} else {
+			http.Error(w, "ログインに失敗しました。もう一度お試しください。", http.StatusInternalServerError)
+		}
+
+		return oidc.Identity{}, model.AuthTransaction{}, false
+	}
+
+	identity, err := provider.Client.Exchange(
+		r.Context(),
+		r.FormValue("code"),
+		callbackUrl(provider.CallbackPath()),
+		tx.CodeVerifier,
+		tx.Nonce,
+	)
+	if err != nil {
+		l.Logger.Error().Err(err).Msg("failed to exchange authorization code")
+		status, msg := tokenErrorResponse(err)
+		http.Error(w, msg, status)
+
+		return oidc.Identity{}, model.AuthTransaction{}, false
+	}
+
+	return identity, tx, true
+}
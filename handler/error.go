@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"sns-login/oidc"
+	"strings"
+)
+
+// tokenErrorResponse は認可コードの交換とユーザーの情報の取得で起きたエラーを、ユーザーに返すステータスコードとメッセージに変換する
+func tokenErrorResponse(err error) (int, string) {
+	// 許可されていない組織のアカウント。別のアカウントでログインし直せば解決する
+	var hdErr *oidc.HostedDomainError
+	if errors.As(err, &hdErr) {
+		return http.StatusForbidden, "このGoogleアカウントではログインできません。" +
+			strings.Join(hdErr.Allowed, ", ") + " のアカウントでログインしてください。"
+	}
+
+	// 許可されていないテナントのアカウント。許可されたテナントのアカウントでログインし直せば解決する
+	var tenantErr *oidc.TenantError
+	if errors.As(err, &tenantErr) {
+		return http.StatusForbidden, "このMicrosoftアカウントではログインできません。" +
+			"ログインできるのは許可された組織(テナント)のアカウントだけです。"
+	}
+
+	// GitHubでメールアドレスを確認すればログインできる
+	var githubEmailErr *oidc.GithubEmailError
+	if errors.As(err, &githubEmailErr) {
+		return http.StatusForbidden, "GitHubアカウントに確認済みのメールアドレスがありません。" +
+			"GitHubでプライマリのメールアドレスを確認してから、もう一度ログインしてください。"
+	}
+
+	// id_tokenやクレームを検証して拒否した。IdPとの通信には成功している
+	var validationErr *oidc.ValidationError
+	if errors.As(err, &validationErr) {
+		return http.StatusUnauthorized, "ログインサービスから受け取った情報を確認できませんでした。もう一度ログインしてください。"
+	}
+
+	var tokenErr *oidc.TokenError
+	if !errors.As(err, &tokenErr) {
+		return http.StatusBadGateway, "ログインサービスとの通信に失敗しました。時間をおいてもう一度お試しください。"
+	}
+
+	switch tokenErr.Code {
+	case oidc.TokenErrorInvalidGrant:
+		// 認可コードの期限切れや使用済み。ユーザーがやり直せば解決する
+		return http.StatusBadRequest, "ログインの有効期限が切れました。もう一度ログインしてください。"
+	case oidc.TokenErrorInvalidClient, oidc.TokenErrorUnauthorizedClient, oidc.TokenErrorUnsupportedGrantType:
+		// クライアントの設定の問題なので、ユーザーがやり直しても解決しない
+		return http.StatusInternalServerError, "ログインの設定に問題があります。管理者にお問い合わせください。"
+	default:
+		return http.StatusBadGateway, "ログインに失敗しました。もう一度お試しください。"
+	}
+}
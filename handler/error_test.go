@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sns-login/oidc"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenErrorResponse(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		err      error
+		expected int
+	}{
+		{"invalid_grant", &oidc.TokenError{Code: oidc.TokenErrorInvalidGrant}, http.StatusBadRequest},
+		{
+			"ラップされたinvalid_client",
+			fmt.Errorf("wrapped: %w", &oidc.TokenError{Code: oidc.TokenErrorInvalidClient}),
+			http.StatusInternalServerError,
+		},
+		{"その他のエラーコード", &oidc.TokenError{Code: "temporarily_unavailable"}, http.StatusBadGateway},
+		{"TokenErrorではない", errors.New("timeout"), http.StatusBadGateway},
+		{
+			"id_tokenの検証に失敗",
+			fmt.Errorf("wrapped: %w", &oidc.ValidationError{Err: errors.New("id_token nonce mismatch")}),
+			http.StatusUnauthorized,
+		},
+		{
+			"許可されていないWorkspaceのドメイン",
+			fmt.Errorf("wrapped: %w", &oidc.HostedDomainError{Hd: "other.com", Allowed: []string{"example.com"}}),
+			http.StatusForbidden,
+		},
+		{
+			"GitHubのメールアドレスが未確認",
+			fmt.Errorf("wrapped: %w", &oidc.GithubEmailError{Login: "octocat"}),
+			http.StatusForbidden,
+		},
+		{
+			"許可されていないMicrosoftのテナント",
+			fmt.Errorf("wrapped: %w", &oidc.TenantError{Tid: "tenant-b", Allowed: []string{"tenant-a"}}),
+			http.StatusForbidden,
+		},
+	}
+
+	for _, pattern := range patterns {
+		status, msg := tokenErrorResponse(pattern.err)
+		assert.Equal(t, pattern.expected, status, pattern.desc)
+		assert.NotEmpty(t, msg, pattern.desc)
+	}
+}
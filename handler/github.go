@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"sns-login/oidc"
+)
+
+const githubProviderName = "github"
+
+func newGithubProvider() (Provider, error) {
+	if os.Getenv("GITHUB_CLIENT_ID") == "" {
+		return Provider{}, errProviderNotConfigured
+	}
+
+	return Provider{
+		Name:        githubProviderName,
+		DisplayName: "GitHub",
+		Client:      oidc.NewGithubClient(),
+		// メールアドレスの一覧を読むためにuser:emailを要求する
+		Scopes:   []string{"read:user", "user:email"},
+		SameSite: http.SameSiteLaxMode,
+	}, nil
+}
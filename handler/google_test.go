@@ -5,13 +5,22 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"testing"
 )
 
-func TestAuthGoogleSignUpHandler(t *testing.T) {
+func TestLoginHandler_Google(t *testing.T) {
+	_ = os.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	defer func() { _ = os.Unsetenv("GOOGLE_CLIENT_ID") }()
+
+	provider, err := newGoogleProvider()
+	assert.Nil(t, err)
+	router := newTestRouter(t, provider)
+
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest(http.MethodGet, "/auth/google/sign_up", nil)
-	AuthGoogleSignUpHandler(w, r)
+	r := httptest.NewRequest(http.MethodGet, "/auth/google/login", nil)
+	router.ServeHTTP(w, r)
 
 	resp := w.Result()
 	defer func(Body io.ReadCloser) {
@@ -21,5 +30,46 @@ func TestAuthGoogleSignUpHandler(t *testing.T) {
 		}
 	}(resp.Body)
 
-	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+
+	location, err := resp.Location()
+	assert.Nil(t, err)
+	assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+	assert.Contains(t, location.Query().Get("redirect_uri"), "/auth/google/callback")
+
+	// code_verifierとnonceはブラウザに渡さず、stateに結びつくcookieだけを渡す
+	assert.Len(t, resp.Cookies(), 1)
+	txCookie := resp.Cookies()[0]
+	assert.Equal(t, "auth_tx_"+location.Query().Get("state"), txCookie.Name)
+	assert.True(t, txCookie.Secure)
+	assert.True(t, txCookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, txCookie.SameSite)
+	assert.Equal(t, "/auth/", txCookie.Path)
+	assert.Greater(t, txCookie.MaxAge, 0)
+	assert.Equal(t, "", location.Query().Get("hd"))
+}
+
+func TestLoginHandler_GoogleHostedDomain(t *testing.T) {
+	_ = os.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	_ = os.Setenv("GOOGLE_ALLOWED_HD", "example.com")
+	defer func() {
+		_ = os.Unsetenv("GOOGLE_CLIENT_ID")
+		_ = os.Unsetenv("GOOGLE_ALLOWED_HD")
+	}()
+
+	provider, err := newGoogleProvider()
+	assert.Nil(t, err)
+	router := newTestRouter(t, provider)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/google/login", nil))
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com", location.Query().Get("hd"))
+}
+
+func TestNewGoogleProvider_NotConfigured(t *testing.T) {
+	_, err := newGoogleProvider()
+	assert.ErrorIs(t, err, errProviderNotConfigured)
 }
@@ -5,12 +5,23 @@ import (
 	"net/http"
 )
 
-func IndexHandler(w http.ResponseWriter, _ *http.Request) {
-	t, err := template.ParseFiles("views/index.html")
-	if err != nil {
-		panic(err.Error())
-	}
-	if err := t.Execute(w, nil); err != nil {
-		panic(err.Error())
+// IndexHandler は有効なIdPのログインボタンを並べたトップページを返す
+func IndexHandler(reg *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := template.ParseFiles("views/index.html")
+		if err != nil {
+			panic(err.Error())
+		}
+		data := struct {
+			Providers []Provider
+			// ReturnTo はログインが必要なページからリダイレクトされてきた場合の、ログイン後に戻るページ
+			ReturnTo string
+		}{Providers: reg.Providers()}
+		if returnTo := r.FormValue("return_to"); returnTo != "" {
+			data.ReturnTo = sanitizeReturnTo(returnTo, returnToAllowedOrigins())
+		}
+		if err := t.Execute(w, data); err != nil {
+			panic(err.Error())
+		}
 	}
 }
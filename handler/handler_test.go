@@ -9,15 +9,28 @@ import (
 )
 
 func TestIndexHandler(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
 	if err := os.Chdir("../"); err != nil {
 		panic(err)
 	}
+	defer func() { _ = os.Chdir(wd) }()
 
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
-	IndexHandler(w, r)
+	reg := NewRegistry()
+	assert.Nil(t, reg.Register(Provider{Name: "keycloak", DisplayName: "Keycloak"}))
+	IndexHandler(reg)(w, r)
 
 	resp := w.Result()
 
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, w.Body.String(), `<a href="/auth/keycloak/login">Keycloakでログイン</a>`)
+
+	// ログインが必要なページからリダイレクトされてきた場合は、ログインのリンクにreturn_toを引き継ぐ
+	w = httptest.NewRecorder()
+	IndexHandler(reg)(w, httptest.NewRequest(http.MethodGet, "/?return_to=%2Fmypage%3Ftab%3D1", nil))
+	assert.Contains(t, w.Body.String(), `<a href="/auth/keycloak/login?return_to=%2fmypage%3ftab%3d1">`)
 }
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"sns-login/oidc"
+)
+
+const lineProviderName = "line"
+
+func newLineProvider() (Provider, error) {
+	if os.Getenv("LINE_CHANNEL_ID") == "" {
+		return Provider{}, errProviderNotConfigured
+	}
+	provider := Provider{
+		Name:        lineProviderName,
+		DisplayName: "LINE",
+		Client:      oidc.NewLineOidcClient(),
+		Scopes:      []string{"openid", "profile", "email"},
+		SameSite:    http.SameSiteLaxMode,
+		AuthOptions: func(r *http.Request) []oidc.AuthOption {
+			// メールアドレスの提供を断ったユーザーには、もう一度同意画面を出す
+			if r.URL.Query().Get("prompt") == "consent" {
+				return []oidc.AuthOption{oidc.WithPrompt("consent")}
+			}
+
+			return nil
+		},
+	}
+	provider.AfterLogin = func(w http.ResponseWriter, _ *http.Request, identity *oidc.Identity) bool {
+		// LINEではメールアドレスの提供をユーザーが断ることができる。その場合はid_tokenにemailが含まれない
+		if identity.Email == "" {
+			http.Error(
+				w,
+				"メールアドレスの提供が許可されませんでした。"+
+					"メールアドレスの提供を許可してもう一度ログインしてください: "+provider.LoginPath()+"?prompt=consent",
+				http.StatusForbidden,
+			)
+
+			return false
+		}
+
+		return true
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sns-login/logger"
+	"sns-login/model"
+	"sns-login/session"
+
+	"gorm.io/gorm"
+)
+
+// LogoutHandler は/logoutで、セッションを削除してトップページにリダイレクトする
+//
+// IdPから受け取ったトークンも返却し、ログアウト後にトークンが使われないようにする。
+// 他のサイトからログアウトさせられないように、POSTだけで受ける
+func LogoutHandler(reg *Registry, db *gorm.DB, sessions *session.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.New(false)
+
+		// 返却に失敗してもログアウトは続けられるように、エラーはログに出力するだけにする
+		sess, err := sessions.Get(r)
+		if err == nil {
+			if err := revokeOauthTokens(r.Context(), db, reg.revoker, sess.UserId); err != nil {
+				l.Logger.Error().Err(err).Msg("failed to revoke oauth tokens")
+			}
+		} else if !errors.Is(err, session.ErrSessionNotFound) && !errors.Is(err, session.ErrSessionExpired) {
+			l.Logger.Error().Err(err).Msg("failed to get session")
+		}
+
+		if err := sessions.Destroy(w, r); err != nil {
+			l.Logger.Error().Err(err).Msg("failed to destroy session")
+			http.Error(w, "ログアウトに失敗しました。もう一度お試しください。", http.StatusInternalServerError)
+
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// UnlinkHandler は/account/unlinkで、IdPとの連携を解除してユーザーを削除する
+//
+// ユーザーは1つのIdPとだけ連携しているので、連携を解除するとユーザーも削除する。
+// 取り消せない操作なので、RequireLoginとMaxAuthAgeでログインし直したユーザーだけに許可する
+func UnlinkHandler(reg *Registry, db *gorm.DB, sessions *session.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.New(false)
+		user, ok := CurrentUser(r.Context())
+		if !ok {
+			unauthenticated(w, r, "login_required")
+
+			return
+		}
+
+		// トークンを返却できないまま削除すると、IdP側に連携が残ってしまうのでやり直してもらう
+		if err := revokeOauthTokens(r.Context(), db, reg.revoker, user.ID); err != nil {
+			l.Logger.Error().Err(err).Msg("failed to revoke oauth tokens")
+			http.Error(w, "連携の解除に失敗しました。時間をおいてもう一度お試しください。", http.StatusBadGateway)
+
+			return
+		}
+		if err := deleteUser(db, user); err != nil {
+			l.Logger.Error().Err(err).Msg("failed to delete user")
+			http.Error(w, "連携の解除に失敗しました。もう一度お試しください。", http.StatusInternalServerError)
+
+			return
+		}
+		if err := sessions.Destroy(w, r); err != nil {
+			l.Logger.Error().Err(err).Msg("failed to destroy session")
+		}
+		l.Logger.Info().Msgf("success to unlink user %d from %s", user.ID, user.IdProvider)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// deleteUser はユーザーとセッション、トークンを削除する
+//
+// 同じIdPのアカウントで登録し直せるように、(IdProvider, Sub)の一意制約に残らないよう物理削除する
+func deleteUser(db *gorm.DB, user model.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&model.Session{}).Error; err != nil {
+			return fmt.Errorf("failed to delete sessions: %w", err)
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&model.OauthToken{}).Error; err != nil {
+			return fmt.Errorf("failed to delete oauth tokens: %w", err)
+		}
+		if err := tx.Unscoped().Delete(&user).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		return nil
+	})
+}
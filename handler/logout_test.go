@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sns-login/model"
+	"sns-login/session"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRevokingClient はトークンを返却できるIdPのクライアント
+type fakeRevokingClient struct {
+	*fakeLoginClient
+	*fakeRevoker
+}
+
+func TestUnlinkHandler(t *testing.T) {
+	patterns := []struct {
+		desc           string
+		revokeErr      error
+		expectedStatus int
+		isExpectDelete bool
+	}{
+		{"返却できた", nil, http.StatusSeeOther, true},
+		{"返却に失敗", errors.New("temporarily unavailable"), http.StatusBadGateway, false},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			db := newTestDb(t)
+			user := model.User{IdProvider: "keycloak", Sub: "248289761001"}
+			db.Create(&user)
+			db.Create(&model.OauthToken{UserId: user.ID, IdProvider: "keycloak", AccessToken: "at"})
+
+			revoker := &fakeRevoker{errs: map[string]error{"at": pattern.revokeErr}}
+			provider := Provider{Name: "keycloak", Client: fakeRevokingClient{&fakeLoginClient{}, revoker}}
+			reg := NewRegistry()
+			assert.Nil(t, reg.Register(provider))
+			router := newTestRouterWithDb(t, db, provider)
+			router.Handle("/account/unlink", RequireLogin()(UnlinkHandler(reg, db, session.NewStore(db))))
+
+			r := httptest.NewRequest(http.MethodPost, "/account/unlink", nil)
+			r.AddCookie(loginAs(t, db, user))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, pattern.expectedStatus, w.Code)
+			assert.Equal(t, []string{"at"}, revoker.revoked)
+
+			// 返却に失敗した場合はユーザーもトークンも残して、やり直せるようにする
+			for _, m := range []interface{}{&model.User{}, &model.OauthToken{}, &model.Session{}} {
+				var count int64
+				db.Unscoped().Model(m).Count(&count)
+				if pattern.isExpectDelete {
+					assert.Equal(t, int64(0), count)
+				} else {
+					assert.Equal(t, int64(1), count)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"sns-login/oidc"
+)
+
+const microsoftProviderName = "microsoft"
+
+func newMicrosoftProvider() (Provider, error) {
+	if os.Getenv("MICROSOFT_CLIENT_ID") == "" {
+		return Provider{}, errProviderNotConfigured
+	}
+
+	// 許可していないテナントのユーザーはid_tokenの検証で拒否される
+	return Provider{
+		Name:        microsoftProviderName,
+		DisplayName: "Microsoft",
+		Client:      oidc.NewMicrosoftOidcClient(),
+		Scopes:      []string{"openid", "email", "profile"},
+		SameSite:    http.SameSiteLaxMode,
+	}, nil
+}
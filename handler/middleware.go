@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sns-login/logger"
+	"sns-login/model"
+	"sns-login/session"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// contextKey はリクエストのcontextに値を保存するためのキー。他のパッケージのキーと衝突しないように型を分ける
+type contextKey int
+
+const (
+	currentUserKey contextKey = iota
+	currentSessionKey
+)
+
+// CurrentUser はLoadUserがcontextに保存したログイン中のユーザーを返す。ログインしていなければfalse
+func CurrentUser(ctx context.Context) (model.User, bool) {
+	user, ok := ctx.Value(currentUserKey).(model.User)
+
+	return user, ok
+}
+
+// CurrentSession はLoadUserがcontextに保存したログイン中のセッションを返す。ログインしていなければfalse
+func CurrentSession(ctx context.Context) (model.Session, bool) {
+	sess, ok := ctx.Value(currentSessionKey).(model.Session)
+
+	return sess, ok
+}
+
+// LoadUser はセッションのcookieからログイン中のユーザーを探し、リクエストのcontextに保存するミドルウェアを返す
+//
+// ログインしていなくてもリクエストは拒否しないので、全てのルートに使える。拒否する場合はRequireLoginを組み合わせる
+func LoadUser(db *gorm.DB, sessions *session.Store) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := logger.New(false)
+
+			sess, err := sessions.Get(r)
+			if err != nil {
+				if !errors.Is(err, session.ErrSessionNotFound) && !errors.Is(err, session.ErrSessionExpired) {
+					l.Logger.Error().Err(err).Msg("failed to get session")
+				}
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			var user model.User
+			if err := db.First(&user, sess.UserId).Error; err != nil {
+				// 削除されたユーザーのセッションはログインしていないものとして扱う
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					l.Logger.Error().Err(err).Msg("failed to find user")
+				}
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), currentUserKey, user)
+			ctx = context.WithValue(ctx, currentSessionKey, sess)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Requirement はログイン中のユーザーがルートにアクセスできるかを判定する。満たさない場合は再ログインを求める
+type Requirement func(user model.User, sess model.Session, now time.Time) bool
+
+// MaxAuthAge はmaxAge以内にログインしたユーザーだけを許可する
+//
+// アカウントの削除のような重要な操作の前に、ログインし直してもらうために使う
+func MaxAuthAge(maxAge time.Duration) Requirement {
+	return func(_ model.User, sess model.Session, now time.Time) bool {
+		// セッションはログインするたびに作り直すので、作成した時刻がログインした時刻になる
+		return now.Sub(sess.CreatedAt) <= maxAge
+	}
+}
+
+// RequireLogin はログインしていないリクエストを拒否するミドルウェアを返す。LoadUserの後に使う
+//
+// ブラウザはログイン画面のトップページにリダイレクトし、APIのクライアントには401をJSONで返す
+func RequireLogin(requirements ...Requirement) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := CurrentUser(r.Context())
+			if !ok {
+				unauthenticated(w, r, "login_required")
+
+				return
+			}
+			sess, _ := CurrentSession(r.Context())
+			now := time.Now()
+			for _, requirement := range requirements {
+				if !requirement(user, sess, now) {
+					unauthenticated(w, r, "reauthentication_required")
+
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unauthenticated はログインしていないか、ログインし直す必要があることをクライアントに伝える
+//
+// ブラウザのGETはログインした後に元のページに戻れるように、return_to付きでログイン画面にリダイレクトする
+func unauthenticated(w http.ResponseWriter, r *http.Request, errCode string) {
+	if !isApiRequest(r) {
+		loginUrl := "/"
+		if r.Method == http.MethodGet {
+			loginUrl += "?return_to=" + url.QueryEscape(r.URL.RequestURI())
+		}
+		http.Redirect(w, r, loginUrl, http.StatusSeeOther)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": errCode}); err != nil {
+		l := logger.New(false)
+		l.Logger.Error().Err(err).Msg("failed to write response")
+	}
+}
+
+// isApiRequest はJSONのレスポンスを求めるAPIのクライアントからのリクエストかどうか
+func isApiRequest(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
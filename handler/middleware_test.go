@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sns-login/model"
+	"sns-login/session"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// loginAs はユーザーのセッションを作成し、そのcookieを返す
+func loginAs(t *testing.T, db *gorm.DB, user model.User) *http.Cookie {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	if _, err := session.NewStore(db).Create(w, httptest.NewRequest(http.MethodGet, "/", nil), user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	return w.Result().Cookies()[0]
+}
+
+func TestRequireLogin(t *testing.T) {
+	patterns := []struct {
+		desc           string
+		isLoggedIn     bool
+		loggedInBefore time.Duration
+		accept         string
+		expectedStatus int
+		expectedError  string
+	}{
+		{"ログイン中", true, 0, "text/html", http.StatusOK, ""},
+		{"ログインしていないブラウザ", false, 0, "text/html,application/xhtml+xml", http.StatusSeeOther, ""},
+		{"ログインしていないAPIのクライアント", false, 0, "application/json", http.StatusUnauthorized, "login_required"},
+		{"ログインしてから時間が経ったブラウザ", true, 10 * time.Minute, "text/html", http.StatusSeeOther, ""},
+		{
+			"ログインしてから時間が経ったAPIのクライアント",
+			true,
+			10 * time.Minute,
+			"application/json",
+			http.StatusUnauthorized,
+			"reauthentication_required",
+		},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			db := newTestDb(t)
+			user := model.User{Name: "Jane Doe", IdProvider: "google", Sub: "248289761001"}
+			db.Create(&user)
+
+			router := mux.NewRouter()
+			router.Use(LoadUser(db, session.NewStore(db)))
+			router.Handle("/private", RequireLogin(MaxAuthAge(5*time.Minute))(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					current, ok := CurrentUser(r.Context())
+					assert.True(t, ok)
+					assert.Equal(t, user.ID, current.ID)
+				},
+			)))
+
+			r := httptest.NewRequest(http.MethodGet, "/private", nil)
+			r.Header.Set("Accept", pattern.accept)
+			if pattern.isLoggedIn {
+				r.AddCookie(loginAs(t, db, user))
+				db.Model(&model.Session{}).Where("user_id = ?", user.ID).
+					Update("created_at", time.Now().Add(-pattern.loggedInBefore))
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, pattern.expectedStatus, w.Code)
+			if pattern.expectedStatus == http.StatusSeeOther {
+				// ログインした後に元のページに戻ってこられる
+				assert.Equal(t, "/?return_to=%2Fprivate", w.Header().Get("Location"))
+			}
+			if pattern.expectedError != "" {
+				var body map[string]string
+				assert.Nil(t, json.NewDecoder(w.Body).Decode(&body))
+				assert.Equal(t, pattern.expectedError, body["error"])
+			}
+		})
+	}
+}
+
+func TestLoadUser_DeletedUser(t *testing.T) {
+	db := newTestDb(t)
+	user := model.User{IdProvider: "google", Sub: "248289761001"}
+	db.Create(&user)
+	cookie := loginAs(t, db, user)
+	db.Unscoped().Delete(&user)
+
+	var isLoggedIn bool
+	handler := LoadUser(db, session.NewStore(db))(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		_, isLoggedIn = CurrentUser(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.False(t, isLoggedIn)
+}
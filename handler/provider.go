@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sns-login/logger"
+	"sns-login/oidc"
+	"sns-login/session"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var (
+	errProviderNotConfigured = errors.New("provider not configured")
+	errDuplicateProvider     = errors.New("duplicate provider name")
+	errReservedProviderName  = errors.New("provider name reserved for built-in provider")
+)
+
+// Provider はログインに使えるIdPの設定
+type Provider struct {
+	// Name は/auth/{name}/loginのようにURLのパスに使い、model.UserにIdPとして保存する名前。変更しないこと
+	Name string
+	// DisplayName はトップページに表示する名前
+	DisplayName string
+	Client      loginClient
+	Scopes      []string
+	// SameSite はログインの途中で使うcookieのSameSite。form_postで戻ってくるIdPではhttp.SameSiteNoneMode
+	SameSite http.SameSite
+	// AuthOptions はリクエストに応じて認可リクエストに追加するパラメータを返す。nilでもよい
+	AuthOptions func(r *http.Request) []oidc.AuthOption
+	// AfterLogin はユーザーを保存する前にIdP固有の処理を行う。拒否する場合はレスポンスを書き込んでfalseを返す。nilでもよい
+	AfterLogin func(w http.ResponseWriter, r *http.Request, identity *oidc.Identity) bool
+}
+
+// LoginPath はIdPのログイン画面にリダイレクトするパス
+func (p Provider) LoginPath() string {
+	return "/auth/" + p.Name + "/login"
+}
+
+// CallbackPath はIdPのログイン画面から戻ってくるパス。IdPにリダイレクトURIとして登録する
+func (p Provider) CallbackPath() string {
+	return "/auth/" + p.Name + "/callback"
+}
+
+// Registry は有効なIdPを名前で引けるようにまとめたもの
+type Registry struct {
+	providers map[string]Provider
+	// names は登録した順番。トップページにこの順番で表示する
+	names []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{providers: map[string]Provider{}}
+}
+
+// Register はIdPを登録する。同じ名前のIdPはすでに登録されていればエラーにする
+func (reg *Registry) Register(provider Provider) error {
+	if _, ok := reg.providers[provider.Name]; ok {
+		return fmt.Errorf("%w: %s", errDuplicateProvider, provider.Name)
+	}
+	reg.providers[provider.Name] = provider
+	reg.names = append(reg.names, provider.Name)
+
+	return nil
+}
+
+// Get は名前からIdPを返す
+func (reg *Registry) Get(name string) (Provider, bool) {
+	provider, ok := reg.providers[name]
+
+	return provider, ok
+}
+
+// Providers は登録されたIdPを登録した順番で返す
+func (reg *Registry) Providers() []Provider {
+	providers := make([]Provider, 0, len(reg.names))
+	for _, name := range reg.names {
+		providers = append(providers, reg.providers[name])
+	}
+
+	return providers
+}
+
+// builtinProvider は組み込みのIdPの名前と、そのProviderを環境変数から作る関数
+type builtinProvider struct {
+	name        string
+	newProvider func() (Provider, error)
+}
+
+// builtinProviders は組み込みのIdP。ここにある名前は、環境変数を設定していなくても設定ファイルのIdPには使えない
+var builtinProviders = []builtinProvider{
+	{googleProviderName, newGoogleProvider},
+	{appleProviderName, newAppleProvider},
+	{microsoftProviderName, newMicrosoftProvider},
+	{githubProviderName, newGithubProvider},
+	{lineProviderName, newLineProvider},
+	{yahooJapanProviderName, newYahooJapanProvider},
+}
+
+// RegisterBuiltinProviders は組み込みのIdPのうち、環境変数が設定されているものを登録する
+func (reg *Registry) RegisterBuiltinProviders() {
+	l := logger.New(false)
+	for _, builtin := range builtinProviders {
+		provider, err := builtin.newProvider()
+		if errors.Is(err, errProviderNotConfigured) {
+			continue
+		}
+		if err == nil {
+			err = reg.Register(provider)
+		}
+		if err != nil {
+			l.Logger.Error().Err(err).Msg("failed to register provider")
+		}
+	}
+}
+
+// RegisterGeneric は設定ファイルで宣言したIdPを登録する
+//
+// 組み込みのIdPの名前は、その組み込みのIdPを有効にしていなくても使えない。
+// 使えてしまうと、あとで組み込みのIdPを有効にしたときに、既存のユーザーが組み込みのIdPのユーザーとして扱われる
+func (reg *Registry) RegisterGeneric(config oidc.GenericProviderConfig, client loginClient) error {
+	for _, builtin := range builtinProviders {
+		if config.Name == builtin.name {
+			return fmt.Errorf("%w: %s", errReservedProviderName, config.Name)
+		}
+	}
+
+	return reg.Register(newGenericProvider(config, client))
+}
+
+// newGenericProvider は設定ファイルで宣言したIdPのProviderを返す
+func newGenericProvider(config oidc.GenericProviderConfig, client loginClient) Provider {
+	return Provider{
+		Name:        config.Name,
+		DisplayName: config.DisplayName,
+		Client:      client,
+		Scopes:      config.Scopes,
+		SameSite:    http.SameSiteLaxMode,
+	}
+}
+
+// providerFromRequest はパスの{provider}に対応するIdPを返す。登録されていなければ404を返してfalse
+func providerFromRequest(w http.ResponseWriter, r *http.Request, reg *Registry) (Provider, bool) {
+	provider, ok := reg.Get(mux.Vars(r)["provider"])
+	if !ok {
+		http.NotFound(w, r)
+	}
+
+	return provider, ok
+}
+
+// LoginHandler は/auth/{provider}/loginで、ユーザーをIdPのログイン画面にリダイレクトする
+func LoginHandler(reg *Registry, txs *session.TransactionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, ok := providerFromRequest(w, r, reg)
+		if !ok {
+			return
+		}
+
+		var authOptions []oidc.AuthOption
+		if provider.AuthOptions != nil {
+			authOptions = provider.AuthOptions(r)
+		}
+		// ログイン後に元のページに戻れるように、リダイレクト先をログインの試行と一緒に保存する
+		returnTo := sanitizeReturnTo(r.FormValue("return_to"), returnToAllowedOrigins())
+		redirectToIdp(w, r, txs, provider, returnTo, authOptions...)
+	}
+}
+
+// CallbackHandler は/auth/{provider}/callbackで、IdPのログイン画面から戻ってきたユーザーをログインさせる
+//
+// クエリで戻ってくるIdPとform_postで戻ってくるIdPがあるので、GETとPOSTの両方で受ける。
+// ログインできた場合はセッションを作成し、ログインを始めたときのreturn_toにリダイレクトする
+func CallbackHandler(
+	reg *Registry,
+	db *gorm.DB,
+	sessions *session.Store,
+	txs *session.TransactionStore,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.New(false)
+		provider, ok := providerFromRequest(w, r, reg)
+		if !ok {
+			return
+		}
+
+		// ユーザーが認可をキャンセルした場合などはerrorパラメータ付きで戻ってくる
+		if errCode := r.FormValue("error"); errCode != "" {
+			l.Logger.Info().Msgf("%s authorization error: %s", provider.Name, errCode)
+			// 同じstateで続きができないように、ログインの試行は破棄する
+			_, _ = txs.Complete(w, r, r.FormValue("state"), provider.Name, provider.SameSite)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+
+			return
+		}
+
+		identity, tx, ok := completeLogin(w, r, txs, provider)
+		if !ok {
+			return
+		}
+		if provider.AfterLogin != nil && !provider.AfterLogin(w, r, &identity) {
+			return
+		}
+
+		user, result, err := signIn(db, identity, provider.Name, isSignUpClosed())
+		if err != nil {
+			l.Logger.Error().Err(err).Msg("failed to sign in")
+			http.Error(w, "ログインに失敗しました。もう一度お試しください。", http.StatusInternalServerError)
+
+			return
+		}
+		switch result {
+		case signInRejected:
+			l.Logger.Info().Msgf("sign up is closed: %s", provider.Name)
+			http.Error(w, "現在、新規登録は受け付けていません。", http.StatusForbidden)
+
+			return
+		case signInCreated:
+			l.Logger.Info().Msgf("success to create user %d with %s", user.ID, provider.Name)
+		case signInExisting:
+			l.Logger.Info().Msgf("success to sign in user %d with %s", user.ID, provider.Name)
+		}
+
+		if _, err := sessions.Create(w, r, user.ID); err != nil {
+			l.Logger.Error().Err(err).Msg("failed to create session")
+			http.Error(w, "ログインに失敗しました。もう一度お試しください。", http.StatusInternalServerError)
+
+			return
+		}
+		// 保存してからRETURN_TO_ALLOWED_ORIGINSが変更されている場合もあるので、リダイレクトする前にもう一度確認する
+		// 301はブラウザにキャッシュされるので、POSTのform_postの後でもGETでリダイレクトされる303を使う
+		http.Redirect(w, r, sanitizeReturnTo(tx.ReturnTo, returnToAllowedOrigins()), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sns-login/model"
+	"sns-login/oidc"
+	"sns-login/session"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newTestRouter(t *testing.T, providers ...Provider) *mux.Router {
+	t.Helper()
+
+	return newTestRouterWithDb(t, newTestDb(t), providers...)
+}
+
+func newTestRouterWithDb(t *testing.T, db *gorm.DB, providers ...Provider) *mux.Router {
+	t.Helper()
+
+	reg := NewRegistry()
+	for _, provider := range providers {
+		if err := reg.Register(provider); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions := session.NewStore(db)
+	txs := session.NewTransactionStore(db)
+	router := mux.NewRouter()
+	router.Use(LoadUser(db, sessions))
+	router.HandleFunc("/auth/{provider}/login", LoginHandler(reg, txs)).Methods("GET")
+	router.HandleFunc("/auth/{provider}/callback", CallbackHandler(reg, db, sessions, txs)).Methods("GET", "POST")
+	router.HandleFunc("/logout", LogoutHandler(reg, db, sessions)).Methods("POST")
+
+	return router
+}
+
+// beginLogin はIdPのログイン画面にリダイレクトする前の状態を作り、stateとブラウザのcookieを返す
+func beginLogin(
+	t *testing.T,
+	txs *session.TransactionStore,
+	provider Provider,
+) (string, *http.Cookie, model.AuthTransaction) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	tx, state, err := txs.Begin(w, provider.Name, "", provider.SameSite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state, w.Result().Cookies()[0], tx
+}
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	assert.Nil(t, reg.Register(Provider{Name: "google"}))
+	assert.Nil(t, reg.Register(Provider{Name: "keycloak"}))
+	assert.ErrorIs(t, reg.Register(Provider{Name: "google"}), errDuplicateProvider)
+
+	provider, ok := reg.Get("keycloak")
+	assert.True(t, ok)
+	assert.Equal(t, "/auth/keycloak/login", provider.LoginPath())
+	assert.Equal(t, "/auth/keycloak/callback", provider.CallbackPath())
+	_, ok = reg.Get("unknown")
+	assert.False(t, ok)
+
+	// 登録した順番で返す
+	var names []string
+	for _, v := range reg.Providers() {
+		names = append(names, v.Name)
+	}
+	assert.Equal(t, []string{"google", "keycloak"}, names)
+}
+
+func TestRegistry_RegisterGeneric(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		name     string
+		expected error
+	}{
+		{"新しい名前", "okta", nil},
+		// 組み込みのIdPを有効にしていなくても使えない
+		{"組み込みのIdPと同じ名前", "google", errReservedProviderName},
+		{"登録済みのIdPと同じ名前", "keycloak", errDuplicateProvider},
+	}
+
+	for _, pattern := range patterns {
+		reg := NewRegistry()
+		assert.Nil(t, reg.Register(Provider{Name: "keycloak"}), pattern.desc)
+
+		err := reg.RegisterGeneric(oidc.GenericProviderConfig{Name: pattern.name}, &fakeLoginClient{})
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+			_, ok := reg.Get(pattern.name)
+			assert.True(t, ok, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+}
+
+func TestLoginHandler_UnknownProvider(t *testing.T) {
+	router := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/unknown/login", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCallbackHandler(t *testing.T) {
+	patterns := []struct {
+		desc              string
+		method            string
+		form              url.Values
+		afterLogin        bool
+		expectedStatus    int
+		expectedUserCount int64
+		isExpectSession   bool
+	}{
+		{"クエリで戻ってくる", http.MethodGet, url.Values{"code": {"c"}}, true, http.StatusSeeOther, 1, true},
+		{"form_postで戻ってくる", http.MethodPost, url.Values{"code": {"c"}}, true, http.StatusSeeOther, 1, true},
+		{"AfterLoginで拒否", http.MethodGet, url.Values{"code": {"c"}}, false, http.StatusForbidden, 0, false},
+		{
+			"ユーザーがキャンセル",
+			http.MethodPost,
+			url.Values{"error": {"user_cancelled_authorize"}},
+			true,
+			http.StatusSeeOther,
+			0,
+			false,
+		},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			db := newTestDb(t)
+			afterLogin := pattern.afterLogin
+			provider := Provider{
+				Name:   "keycloak",
+				Client: &fakeLoginClient{identity: oidc.Identity{Subject: "248289761001", Email: "jane@example.com"}},
+				AfterLogin: func(w http.ResponseWriter, _ *http.Request, _ *oidc.Identity) bool {
+					if !afterLogin {
+						w.WriteHeader(http.StatusForbidden)
+					}
+
+					return afterLogin
+				},
+			}
+			router := newTestRouterWithDb(t, db, provider)
+			state, cookie, _ := beginLogin(t, session.NewTransactionStore(db), provider)
+			pattern.form.Set("state", state)
+
+			var r *http.Request
+			if pattern.method == http.MethodGet {
+				r = httptest.NewRequest(http.MethodGet, "/auth/keycloak/callback?"+pattern.form.Encode(), nil)
+			} else {
+				r = httptest.NewRequest(http.MethodPost, "/auth/keycloak/callback", strings.NewReader(pattern.form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			r.AddCookie(cookie)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, pattern.expectedStatus, w.Code)
+
+			var count int64
+			db.Model(&model.User{}).Where("id_provider = ? AND sub = ?", "keycloak", "248289761001").Count(&count)
+			assert.Equal(t, pattern.expectedUserCount, count)
+
+			var sessionCookie *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == session.CookieName {
+					sessionCookie = c
+				}
+			}
+			assert.Equal(t, pattern.isExpectSession, sessionCookie != nil)
+
+			// 一度使ったstateは使えない
+			db.Model(&model.AuthTransaction{}).Count(&count)
+			assert.Equal(t, int64(0), count)
+		})
+	}
+}
+
+func TestLogoutHandler(t *testing.T) {
+	db := newTestDb(t)
+	revoker := &fakeRevoker{}
+	client := &fakeLoginClient{identity: oidc.Identity{
+		Subject: "248289761001",
+		Token:   oidc.Token{AccessToken: "at", RefreshToken: "rt"},
+	}}
+	provider := Provider{Name: "keycloak", Client: fakeRevokingClient{client, revoker}}
+	router := newTestRouterWithDb(t, db, provider)
+
+	// コールバックでログインして、作成したユーザーのセッションを得る
+	state, cookie, _ := beginLogin(t, session.NewTransactionStore(db), provider)
+	r := httptest.NewRequest(http.MethodGet, "/auth/keycloak/callback?code=c&state="+state, nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	var user model.User
+	assert.Nil(t, db.Where("id_provider = ? AND sub = ?", "keycloak", "248289761001").First(&user).Error)
+	var sess model.Session
+	assert.Nil(t, db.First(&sess).Error)
+	assert.NotZero(t, user.ID)
+	assert.Equal(t, user.ID, sess.UserId)
+	var token model.OauthToken
+	assert.Nil(t, db.First(&token).Error)
+	assert.Equal(t, user.ID, token.UserId)
+
+	r = httptest.NewRequest(http.MethodPost, "/logout", nil)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == session.CookieName {
+			r.AddCookie(c)
+		}
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	// IdPでトークンを失効させてから、トークンもセッションも物理削除する
+	assert.Equal(t, []string{"rt", "at"}, revoker.revoked)
+	for _, m := range []interface{}{&model.Session{}, &model.OauthToken{}} {
+		var count int64
+		db.Unscoped().Model(m).Count(&count)
+		assert.Equal(t, int64(0), count)
+	}
+
+	// ログアウトしたセッションIDは使えない
+	_, err := session.NewStore(db).Get(r)
+	assert.ErrorIs(t, err, session.ErrSessionNotFound)
+}
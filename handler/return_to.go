@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultReturnTo はreturn_toがないか、許可されていない場合にログイン後にリダイレクトするパス
+const defaultReturnTo = "/"
+
+// returnToAllowedOrigins はreturn_toとして許可する他のオリジン。RETURN_TO_ALLOWED_ORIGINSにカンマ区切りで設定する
+func returnToAllowedOrigins() []string {
+	var origins []string
+	for _, v := range strings.Split(os.Getenv("RETURN_TO_ALLOWED_ORIGINS"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			origins = append(origins, strings.TrimSuffix(v, "/"))
+		}
+	}
+
+	return origins
+}
+
+// sanitizeReturnTo はログイン後のリダイレクト先として安全なreturn_toを返す。安全でなければdefaultReturnToを返す
+//
+// オープンリダイレクトを防ぐため、同じオリジンの相対パスか、allowedOriginsに含まれるオリジンのURLだけを許可する。
+// "//evil.example.com"や"/\evil.example.com"はブラウザが別のホストとして扱うので拒否する
+func sanitizeReturnTo(returnTo string, allowedOrigins []string) string {
+	if returnTo == "" || strings.ContainsAny(returnTo, "\\\r\n\t") {
+		return defaultReturnTo
+	}
+	u, err := url.Parse(returnTo)
+	if err != nil {
+		return defaultReturnTo
+	}
+
+	if u.Scheme == "" && u.Host == "" && u.User == nil {
+		if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+			return defaultReturnTo
+		}
+
+		return returnTo
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return defaultReturnTo
+	}
+	if u.User != nil {
+		return defaultReturnTo
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, v := range allowedOrigins {
+		if strings.EqualFold(origin, v) {
+			return returnTo
+		}
+	}
+
+	return defaultReturnTo
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sns-login/model"
+	"sns-login/oidc"
+	"sns-login/session"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeReturnTo(t *testing.T) {
+	allowedOrigins := []string{"https://app.example.com"}
+	patterns := []struct {
+		desc     string
+		returnTo string
+		expected string
+	}{
+		{"空", "", "/"},
+		{"相対パス", "/mypage?tab=1#top", "/mypage?tab=1#top"},
+		{"スラッシュで始まらない", "mypage", "/"},
+		{"プロトコル相対URL", "//evil.example.com/", "/"},
+		{"バックスラッシュ", "/\\evil.example.com/", "/"},
+		{"改行", "/mypage\r\nSet-Cookie: a=b", "/"},
+		{"許可されたオリジン", "https://app.example.com/mypage", "https://app.example.com/mypage"},
+		{"許可されていないオリジン", "https://evil.example.com/", "/"},
+		{"許可されたオリジンのhttp", "http://app.example.com/mypage", "/"},
+		{"ユーザー情報付き", "https://app.example.com@evil.example.com/", "/"},
+		{"javascriptスキーム", "javascript:alert(1)", "/"},
+	}
+
+	for _, pattern := range patterns {
+		assert.Equal(t, pattern.expected, sanitizeReturnTo(pattern.returnTo, allowedOrigins), pattern.desc)
+	}
+}
+
+func TestLoginHandler_ReturnTo(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		returnTo string
+		expected string
+	}{
+		{"相対パス", "/mypage", "/mypage"},
+		{"別のサイト", "https://evil.example.com/", "/"},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			db := newTestDb(t)
+			router := newTestRouterWithDb(t, db, Provider{Name: "keycloak", Client: &fakeLoginClient{}})
+
+			w := httptest.NewRecorder()
+			target := "/auth/keycloak/login?return_to=" + url.QueryEscape(pattern.returnTo)
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			assert.Equal(t, http.StatusSeeOther, w.Code)
+
+			var tx model.AuthTransaction
+			assert.Nil(t, db.First(&tx).Error)
+			assert.Equal(t, pattern.expected, tx.ReturnTo)
+		})
+	}
+}
+
+func TestCallbackHandler_ReturnTo(t *testing.T) {
+	db := newTestDb(t)
+	provider := Provider{Name: "keycloak", Client: &fakeLoginClient{identity: oidc.Identity{Subject: "248289761001"}}}
+	router := newTestRouterWithDb(t, db, provider)
+
+	recorder := httptest.NewRecorder()
+	_, state, err := session.NewTransactionStore(db).Begin(recorder, provider.Name, "/mypage", provider.SameSite)
+	assert.Nil(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/auth/keycloak/callback?code=c&state="+state, nil)
+	r.AddCookie(recorder.Result().Cookies()[0])
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/mypage", w.Header().Get("Location"))
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sns-login/model"
+	"sns-login/oidc"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// revokeTimeout はIdPにトークンを返却するリクエストの1回あたりのタイムアウト
+//
+// IdPが応答しなくても、ログアウトや連携の解除が止まったままにならないようにする
+const revokeTimeout = 10 * time.Second
+
+// revoker はIdPにトークンを返却する。oidcClientが実装する
+type revoker interface {
+	Revoke(ctx context.Context, token string, tokenTypeHint string) error
+}
+
+// revokerLookup はIdPの名前からトークンを返却するクライアントを返す。返却できないIdPではfalse
+type revokerLookup func(provider string) (revoker, bool)
+
+// revoker はRegistryに登録されたIdPのクライアントのうち、トークンを返却できるものを返す
+//
+// GitHubのように返却のエンドポイントがないIdPや、設定から削除されたIdPではfalseを返す
+func (reg *Registry) revoker(name string) (revoker, bool) {
+	provider, ok := reg.Get(name)
+	if !ok {
+		return nil, false
+	}
+	client, ok := provider.Client.(revoker)
+
+	return client, ok
+}
+
+// revokeOauthTokens はユーザーについて保存しているトークンを、それぞれ発行したIdPで失効させてから削除する
+//
+// ログアウトやアカウント連携の解除で、IdP側にもトークンが残らないようにするために使う。
+// IdPがすでに失効していると答えたトークンは削除し、それ以外のエラーの場合は削除せずにエラーを返す。
+// 返却できないIdPのトークンは、こちらで保存しないように削除だけする
+func revokeOauthTokens(ctx context.Context, db *gorm.DB, revokers revokerLookup, userId uint) error {
+	var tokens []model.OauthToken
+	if err := db.Where("user_id = ?", userId).Find(&tokens).Error; err != nil {
+		return fmt.Errorf("failed to find oauth tokens: %w", err)
+	}
+
+	for _, token := range tokens {
+		client, ok := revokers(token.IdProvider)
+		if !ok {
+			if err := deleteOauthToken(db, token); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// リフレッシュトークンを失効させると、IdPによっては紐づくアクセストークンも失効する
+		if token.RefreshToken != "" {
+			err := revokeIgnoringInvalid(ctx, client, string(token.RefreshToken), oidc.TokenTypeHintRefreshToken)
+			if err != nil {
+				return err
+			}
+		}
+		if token.AccessToken != "" {
+			err := revokeIgnoringInvalid(ctx, client, string(token.AccessToken), oidc.TokenTypeHintAccessToken)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := deleteOauthToken(db, token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteOauthToken はトークンを削除する。論理削除ではトークンがDBに残るので物理削除する
+func deleteOauthToken(db *gorm.DB, token model.OauthToken) error {
+	if err := db.Unscoped().Delete(&token).Error; err != nil {
+		return fmt.Errorf("failed to delete oauth token: %w", err)
+	}
+
+	return nil
+}
+
+func revokeIgnoringInvalid(ctx context.Context, client revoker, token string, tokenTypeHint string) error {
+	ctx, cancel := context.WithTimeout(ctx, revokeTimeout)
+	defer cancel()
+
+	err := client.Revoke(ctx, token, tokenTypeHint)
+
+	var tokenErr *oidc.TokenError
+	if errors.As(err, &tokenErr) && tokenErr.Code == oidc.TokenErrorInvalidToken {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke %s: %w", tokenTypeHint, err)
+	}
+
+	return nil
+}
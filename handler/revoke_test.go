@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sns-login/model"
+	"sns-login/oidc"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type fakeRevoker struct {
+	revoked []string
+	errs    map[string]error
+	// withoutDeadline は期限のないcontextで返却しようとした回数
+	withoutDeadline int
+}
+
+func (r *fakeRevoker) Revoke(ctx context.Context, token string, _ string) error {
+	r.revoked = append(r.revoked, token)
+	if _, ok := ctx.Deadline(); !ok {
+		r.withoutDeadline++
+	}
+
+	return r.errs[token]
+}
+
+func newTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	if err := model.SetEncryptionKey(make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	}
+	// テストごとに別のインメモリDBを使い、コネクション間では共有する
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDb, err := db.DB(); err == nil {
+			_ = sqlDb.Close()
+		}
+	})
+	if err := db.AutoMigrate(&model.User{}, &model.OauthToken{}, &model.Session{}, &model.AuthTransaction{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// revokers はIdPの名前ごとのfakeRevokerを引くrevokerLookupを返す
+func revokers(byProvider map[string]*fakeRevoker) revokerLookup {
+	return func(provider string) (revoker, bool) {
+		r, ok := byProvider[provider]
+
+		return r, ok
+	}
+}
+
+func TestRevokeOauthTokens(t *testing.T) {
+	db := newTestDb(t)
+	db.Create(&model.OauthToken{UserId: 1, IdProvider: "google", AccessToken: "access1", RefreshToken: "refresh1"})
+	db.Create(&model.OauthToken{UserId: 1, IdProvider: "google", AccessToken: "expired"})
+	db.Create(&model.OauthToken{UserId: 1, IdProvider: "keycloak", AccessToken: "access3"})
+	db.Create(&model.OauthToken{UserId: 1, IdProvider: "github", AccessToken: "not-revocable"})
+	db.Create(&model.OauthToken{UserId: 2, IdProvider: "google", AccessToken: "access2"})
+
+	google := &fakeRevoker{errs: map[string]error{
+		"expired": &oidc.TokenError{Code: oidc.TokenErrorInvalidToken},
+	}}
+	keycloak := &fakeRevoker{}
+	lookup := revokers(map[string]*fakeRevoker{"google": google, "keycloak": keycloak})
+	assert.Nil(t, revokeOauthTokens(context.Background(), db, lookup, 1))
+	// トークンはそれぞれ発行したIdPに返却する
+	assert.Equal(t, []string{"refresh1", "access1", "expired"}, google.revoked)
+	assert.Equal(t, []string{"access3"}, keycloak.revoked)
+	// IdPが応答しなくても止まらないように、期限を付けて返却する
+	assert.Equal(t, 0, google.withoutDeadline+keycloak.withoutDeadline)
+
+	// 論理削除ではなく物理削除する
+	var count int64
+	db.Unscoped().Model(&model.OauthToken{}).Where("user_id = ?", 1).Count(&count)
+	assert.Equal(t, int64(0), count)
+	db.Model(&model.OauthToken{}).Where("user_id = ?", 2).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRevokeOauthTokens_KeepsTokenOnProviderError(t *testing.T) {
+	db := newTestDb(t)
+	db.Create(&model.OauthToken{UserId: 1, IdProvider: "google", AccessToken: "access1"})
+
+	providerErr := errors.New("temporarily unavailable")
+	r := &fakeRevoker{errs: map[string]error{"access1": providerErr}}
+	err := revokeOauthTokens(context.Background(), db, revokers(map[string]*fakeRevoker{"google": r}), 1)
+	assert.ErrorIs(t, err, providerErr)
+
+	var count int64
+	db.Model(&model.OauthToken{}).Where("user_id = ?", 1).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
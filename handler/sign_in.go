@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sns-login/model"
+	"sns-login/oidc"
+
+	"gorm.io/gorm"
+)
+
+// signInResult はIdPから戻ってきたユーザーをどう扱ったか
+type signInResult int
+
+const (
+	// signInCreated は初回のログインでユーザーを作成した
+	signInCreated signInResult = iota + 1
+	// signInExisting はすでに作成済みのユーザーでログインした
+	signInExisting
+	// signInRejected は新規登録を受け付けていないのでログインを拒否した
+	signInRejected
+)
+
+// isSignUpClosed は新規登録を受け付けていないかどうか。SIGN_UP_CLOSED=trueの場合は既存のユーザーだけがログインできる
+func isSignUpClosed() bool {
+	return os.Getenv("SIGN_UP_CLOSED") == "true"
+}
+
+// signIn はIdPの名前とsubでユーザーを探し、初回のログインであればユーザーを作成する
+//
+// 2回目以降のログインではIdPで変更されたメールアドレスや名前を反映し、トークンを新しいものに置き換える。
+// providerにはProvider.Nameを渡す。signUpClosedがtrueでユーザーが見つからない場合はsignInRejectedを返す
+func signIn(db *gorm.DB, identity oidc.Identity, provider string, signUpClosed bool) (model.User, signInResult, error) {
+	var user model.User
+	var result signInResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("id_provider = ? AND sub = ?", provider, identity.Subject).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if signUpClosed {
+				result = signInRejected
+
+				return nil
+			}
+			user = model.User{
+				Email:      identity.Email,
+				Name:       identity.Name,
+				Sub:        identity.Subject,
+				IdProvider: provider,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("failed to create user: %w", err)
+			}
+			result = signInCreated
+		case err != nil:
+			return fmt.Errorf("failed to find user: %w", err)
+		default:
+			if err := updateProfile(tx, &user, identity); err != nil {
+				return err
+			}
+			result = signInExisting
+		}
+
+		return saveOauthToken(tx, user.ID, provider, identity.Token)
+	})
+	if err != nil {
+		return model.User{}, 0, err
+	}
+
+	return user, result, nil
+}
+
+// updateProfile はIdPで変更されたメールアドレスや名前をユーザーに反映する
+//
+// Appleの名前のように初回のログインでしか得られない値があるので、空の値では上書きしない
+func updateProfile(tx *gorm.DB, user *model.User, identity oidc.Identity) error {
+	changes := map[string]interface{}{}
+	if identity.Email != "" && identity.Email != user.Email {
+		changes["email"] = identity.Email
+	}
+	if identity.Name != "" && identity.Name != user.Name {
+		changes["name"] = identity.Name
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if err := tx.Model(user).Updates(changes).Error; err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return nil
+}
+
+// saveOauthToken はユーザーのトークンを保存する。すでに保存していれば新しいトークンで置き換える
+//
+// Googleなどは初回の同意時にしかリフレッシュトークンを返さないので、空の場合は保存済みのリフレッシュトークンを残す
+func saveOauthToken(tx *gorm.DB, userId uint, provider string, token oidc.Token) error {
+	var oauthToken model.OauthToken
+	err := tx.Where("user_id = ? AND id_provider = ?", userId, provider).First(&oauthToken).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to find oauth token: %w", err)
+	}
+
+	oauthToken.UserId = userId
+	oauthToken.IdProvider = provider
+	oauthToken.AccessToken = model.EncryptedString(token.AccessToken)
+	if token.RefreshToken != "" {
+		oauthToken.RefreshToken = model.EncryptedString(token.RefreshToken)
+	}
+	oauthToken.TokenType = token.TokenType
+	oauthToken.Expiry = token.Expiry
+	if err := tx.Save(&oauthToken).Error; err != nil {
+		return fmt.Errorf("failed to save oauth token: %w", err)
+	}
+
+	return nil
+}
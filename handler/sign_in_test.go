@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"sns-login/model"
+	"sns-login/oidc"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignIn(t *testing.T) {
+	db := newTestDb(t)
+	identity := oidc.Identity{
+		Subject: "001.abc",
+		Email:   "x@privaterelay.appleid.com",
+		Name:    "Jane Doe",
+		Token:   oidc.Token{AccessToken: "at", RefreshToken: "rt"},
+	}
+
+	user, result, err := signIn(db, identity, "apple", false)
+	assert.Nil(t, err)
+	assert.Equal(t, signInCreated, result)
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.Equal(t, "apple", user.IdProvider)
+
+	// 2回目のログインでは名前が送られてこず、リフレッシュトークンも返ってこない
+	user, result, err = signIn(db, oidc.Identity{
+		Subject: "001.abc",
+		Email:   "y@privaterelay.appleid.com",
+		Token:   oidc.Token{AccessToken: "at2"},
+	}, "apple", true)
+	assert.Nil(t, err)
+	assert.Equal(t, signInExisting, result)
+
+	var users []model.User
+	assert.Nil(t, db.Find(&users).Error)
+	assert.Len(t, users, 1)
+	assert.Equal(t, user.ID, users[0].ID)
+	assert.Equal(t, "y@privaterelay.appleid.com", users[0].Email)
+	assert.Equal(t, "Jane Doe", users[0].Name)
+
+	var tokens []model.OauthToken
+	assert.Nil(t, db.Where("user_id = ?", user.ID).Find(&tokens).Error)
+	assert.Len(t, tokens, 1)
+	assert.Equal(t, model.EncryptedString("at2"), tokens[0].AccessToken)
+	assert.Equal(t, model.EncryptedString("rt"), tokens[0].RefreshToken)
+}
+
+func TestSignIn_Result(t *testing.T) {
+	patterns := []struct {
+		desc         string
+		provider     string
+		subject      string
+		signUpClosed bool
+		expected     signInResult
+	}{
+		{"既存のユーザー", "google", "248289761001", false, signInExisting},
+		{"新規登録を締め切っていても既存のユーザーはログインできる", "google", "248289761001", true, signInExisting},
+		{"新規のユーザー", "google", "other", false, signInCreated},
+		{"新規登録を締め切っている", "google", "other", true, signInRejected},
+		{"同じsubでも別のIdPは別のユーザー", "github", "248289761001", false, signInCreated},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			db := newTestDb(t)
+			db.Create(&model.User{IdProvider: "google", Sub: "248289761001"})
+
+			_, result, err := signIn(db, oidc.Identity{Subject: pattern.subject}, pattern.provider, pattern.signUpClosed)
+			assert.Nil(t, err)
+			assert.Equal(t, pattern.expected, result)
+
+			var count int64
+			db.Model(&model.User{}).Count(&count)
+			if pattern.expected == signInCreated {
+				assert.Equal(t, int64(2), count)
+			} else {
+				assert.Equal(t, int64(1), count)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"sns-login/oidc"
+)
+
+const yahooJapanProviderName = "yahoo_japan"
+
+func newYahooJapanProvider() (Provider, error) {
+	if os.Getenv("YAHOO_JAPAN_CLIENT_ID") == "" {
+		return Provider{}, errProviderNotConfigured
+	}
+
+	// id_tokenにメールアドレスが含まれないので、UserInfoから補われる
+	return Provider{
+		Name:        yahooJapanProviderName,
+		DisplayName: "Yahoo! JAPAN ID",
+		Client:      oidc.NewYahooJapanOidcClient(),
+		Scopes:      []string{"openid", "profile", "email"},
+		SameSite:    http.SameSiteLaxMode,
+	}, nil
+}
@@ -11,6 +11,9 @@ import (
 	"sns-login/handler"
 	"sns-login/logger"
 	"sns-login/model"
+	"sns-login/oidc"
+	"sns-login/session"
+	"time"
 )
 
 func main() {
@@ -19,6 +22,13 @@ func main() {
 		l.Logger.Error().Err(err)
 	}
 
+	// IdPのトークンを暗号化して保存するための鍵。設定されていなければ起動しない
+	if err := model.LoadEncryptionKey(); err != nil {
+		l.Logger.Error().Err(err).Msg("failed to load encryption key")
+
+		return
+	}
+
 	db, err := gorm.Open(sqlite.Open("./database.db"), &gorm.Config{})
 	if err != nil {
 		l.Logger.Error().Err(err)
@@ -31,14 +41,27 @@ func main() {
 		return
 	}
 
+	// 環境変数や設定ファイルで設定されたIdPだけを有効にする
+	registry := handler.NewRegistry()
+	registry.RegisterBuiltinProviders()
+	registerGenericProviders(registry)
+
+	sessions := session.NewStore(db)
+	txs := session.NewTransactionStore(db)
+
 	router := mux.NewRouter()
-	router.HandleFunc("/", handler.IndexHandler)
-	// ユーザーをGoogleのログイン画面にリダイレクトする
-	router.HandleFunc("/auth/google/sign_up", handler.AuthGoogleSignUpHandler)
-	// Googleのログイン画面からリダイレクトされ戻ってくるときのエンドポイント
-	router.HandleFunc("/auth/google/sign_up/callback", func(w http.ResponseWriter, r *http.Request) {
-		handler.AuthGoogleSignUpCallbackHandler(w, r, db)
-	}).Methods("GET")
+	// 全てのルートでログイン中のユーザーをcontextに保存する
+	router.Use(handler.LoadUser(db, sessions))
+	router.HandleFunc("/", handler.IndexHandler(registry))
+	// ユーザーをIdPのログイン画面にリダイレクトする
+	router.HandleFunc("/auth/{provider}/login", handler.LoginHandler(registry, txs)).Methods("GET")
+	// IdPのログイン画面からリダイレクトされ戻ってくるときのエンドポイント。Appleなどはform_postで戻ってくる
+	router.HandleFunc("/auth/{provider}/callback", handler.CallbackHandler(registry, db, sessions, txs)).
+		Methods("GET", "POST")
+	router.HandleFunc("/logout", handler.LogoutHandler(registry, db, sessions)).Methods("POST")
+	// 連携の解除は取り消せないので、ログインしてから5分以内のユーザーだけに許可する
+	requireRecentLogin := handler.RequireLogin(handler.MaxAuthAge(5 * time.Minute))
+	router.Handle("/account/unlink", requireRecentLogin(handler.UnlinkHandler(registry, db, sessions))).Methods("POST")
 
 	server := http.Server{
 		Handler: router,
@@ -58,10 +81,35 @@ func loadEnv() error {
 	return nil
 }
 
-func initDb(db *gorm.DB) error {
-	if err := db.AutoMigrate(&model.User{}); err != nil {
-		return fmt.Errorf("failed to migrate: %w", err)
+// registerGenericProviders はOIDC_PROVIDERS_FILEの設定ファイルで宣言したIdPを登録する
+//
+// Discoveryに失敗したIdPはログに出力して読み飛ばし、他のIdPでログインできるようにする
+func registerGenericProviders(registry *handler.Registry) {
+	l := logger.New(false)
+	path := os.Getenv("OIDC_PROVIDERS_FILE")
+	if path == "" {
+		return
 	}
 
-	return nil
+	configs, err := oidc.LoadGenericProviderConfigs(path)
+	if err != nil {
+		l.Logger.Error().Err(err).Msg("failed to load provider config")
+
+		return
+	}
+	for _, config := range configs {
+		client, err := oidc.NewGenericOidcClient(config)
+		if err != nil {
+			l.Logger.Error().Err(err).Msg("failed to configure provider")
+
+			continue
+		}
+		if err := registry.RegisterGeneric(config, client); err != nil {
+			l.Logger.Error().Err(err).Msg("failed to register provider")
+		}
+	}
+}
+
+func initDb(db *gorm.DB) error {
+	return model.Migrate(db)
 }
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuthTransaction はIdPのログイン画面にリダイレクトしてから戻ってくるまでの、1回のログインの試行
+//
+// 複数のタブで同時にログインしても上書きされないように、stateごとに保存する。戻ってきたら使い捨てで削除する
+type AuthTransaction struct {
+	gorm.Model
+	// StateHash はstateのハッシュ値。stateは認可リクエストのURLに含まれるので、DBにはそのまま保存しない
+	StateHash string `gorm:"uniqueIndex"`
+	// BindingHash はログインを始めたブラウザのcookieに保存した値のハッシュ値
+	BindingHash  string
+	Nonce        string
+	CodeVerifier string
+	// Provider はログインに使ったIdPの名前。別のIdPのコールバックで使われないように確認する
+	Provider string
+	// ReturnTo はログインした後にリダイレクトするパス
+	ReturnTo  string
+	ExpiresAt time.Time
+}
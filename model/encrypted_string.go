@@ -0,0 +1,140 @@
+package model
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// encryptedPrefix は暗号化した値の先頭に付ける目印。暗号化する前に保存された平文の値と区別する
+const encryptedPrefix = "enc:v1:"
+
+var (
+	errEncryptionKeyMissing = errors.New("encryption key missing")
+	errInvalidEncryptionKey = errors.New("invalid encryption key")
+	errInvalidCiphertext    = errors.New("invalid ciphertext")
+)
+
+var (
+	aeadMu sync.RWMutex
+	aead   cipher.AEAD
+)
+
+// LoadEncryptionKey はTOKEN_ENCRYPTION_KEYからEncryptedStringの暗号化に使う鍵を読み込む
+//
+// 鍵はbase64でエンコードした32バイトの乱数。openssl rand -base64 32 などで生成する
+func LoadEncryptionKey() error {
+	encoded := os.Getenv("TOKEN_ENCRYPTION_KEY")
+	if encoded == "" {
+		return fmt.Errorf("%w: set TOKEN_ENCRYPTION_KEY", errEncryptionKeyMissing)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidEncryptionKey, err)
+	}
+
+	return SetEncryptionKey(key)
+}
+
+// SetEncryptionKey はEncryptedStringの暗号化に使うAES-256の鍵を設定する
+func SetEncryptionKey(key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("%w: must be 32 bytes, got %d", errInvalidEncryptionKey, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidEncryptionKey, err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidEncryptionKey, err)
+	}
+
+	aeadMu.Lock()
+	defer aeadMu.Unlock()
+	aead = gcm
+
+	return nil
+}
+
+func currentAead() (cipher.AEAD, error) {
+	aeadMu.RLock()
+	defer aeadMu.RUnlock()
+	if aead == nil {
+		return nil, errEncryptionKeyMissing
+	}
+
+	return aead, nil
+}
+
+// EncryptedString はDBにAES-GCMで暗号化して保存する文字列
+//
+// アクセストークンやリフレッシュトークンは漏れるとユーザーの代わりにIdPのAPIを呼べてしまうので、
+// DBのファイルやバックアップが漏れても使えないように暗号化する
+type EncryptedString string
+
+// Value はDBに保存するために暗号化する。空文字はそのまま保存する
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	gcm, err := currentAead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(s), nil)
+
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Scan はDBから読み込んだ値を復号する
+//
+// 暗号化する前に保存された値は目印がないので、平文としてそのまま読み込む。次に保存するときに暗号化される
+func (s *EncryptedString) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("%w: unexpected type %T", errInvalidCiphertext, value)
+	}
+
+	if !strings.HasPrefix(raw, encryptedPrefix) {
+		*s = EncryptedString(raw)
+
+		return nil
+	}
+	gcm, err := currentAead()
+	if err != nil {
+		return err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(raw, encryptedPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return errInvalidCiphertext
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidCiphertext, err)
+	}
+	*s = EncryptedString(plain)
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	if err := SetEncryptionKey(make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// インメモリDBは最後のコネクションを閉じると消えるので、-countで繰り返しても前の実行のテーブルが残らない
+	t.Cleanup(func() {
+		if sqlDb, err := db.DB(); err == nil {
+			_ = sqlDb.Close()
+		}
+	})
+
+	return db
+}
+
+func TestEncryptedString(t *testing.T) {
+	db := newTestDb(t)
+	if err := db.AutoMigrate(&OauthToken{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&OauthToken{UserId: 1, AccessToken: "access-token", RefreshToken: ""})
+
+	// DBには平文で保存しない
+	var raw struct {
+		AccessToken  string
+		RefreshToken string
+	}
+	db.Raw("SELECT access_token, refresh_token FROM oauth_tokens").Scan(&raw)
+	assert.NotContains(t, raw.AccessToken, "access-token")
+	assert.Equal(t, "", raw.RefreshToken)
+
+	var token OauthToken
+	assert.Nil(t, db.First(&token).Error)
+	assert.Equal(t, EncryptedString("access-token"), token.AccessToken)
+}
+
+func TestEncryptedString_Scan(t *testing.T) {
+	assert.Nil(t, SetEncryptionKey(make([]byte, 32)))
+	encrypted, err := EncryptedString("access-token").Value()
+	assert.Nil(t, err)
+
+	patterns := []struct {
+		desc          string
+		value         interface{}
+		isExpectValid bool
+		expected      EncryptedString
+	}{
+		{"暗号化した値", encrypted, true, "access-token"},
+		{"暗号化する前に保存した平文", "legacy-token", true, "legacy-token"},
+		{"NULL", nil, true, ""},
+		{"改ざんされた値", encrypted.(string) + "AA", false, ""},
+	}
+
+	for _, pattern := range patterns {
+		var actual EncryptedString
+		err := actual.Scan(pattern.value)
+		assert.Equal(t, pattern.isExpectValid, err == nil, pattern.desc)
+		assert.Equal(t, pattern.expected, actual, pattern.desc)
+	}
+}
+
+func TestSetEncryptionKey(t *testing.T) {
+	assert.ErrorIs(t, SetEncryptionKey([]byte("short")), errInvalidEncryptionKey)
+}
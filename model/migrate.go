@@ -0,0 +1,194 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+var errLegacyGenericProvider = errors.New("legacy generic provider unknown")
+
+// legacyIdProviders はIdProviderを整数で保存していたときの値と、今のIdPの名前の対応
+//
+// 7(Generic)は設定ファイルから追加したどのIdPかわからないので、LEGACY_GENERIC_PROVIDERで指定してもらう
+var legacyIdProviders = map[string]string{
+	"1": "google",
+	"2": "apple",
+	"3": "microsoft",
+	"4": "github",
+	"5": "line",
+	"6": "yahoo_japan",
+}
+
+const legacyGenericIdProvider = "7"
+
+// idProviderTables はid_providerの列を持つテーブル
+var idProviderTables = []string{"users", "oauth_tokens"}
+
+// userIdTables はusers.idを参照するuser_idの列を持つテーブル
+var userIdTables = []string{"oauth_tokens", "sessions"}
+
+// Migrate は古い形式のデータを今の形式に変換してから、テーブルを作成・更新する
+func Migrate(db *gorm.DB) error {
+	if err := migrateIdProviders(db, os.Getenv("LEGACY_GENERIC_PROVIDER")); err != nil {
+		return err
+	}
+	// AutoMigrateで(id_provider, sub)の一意インデックスを作る前に重複をなくしておく
+	if err := mergeDuplicateUsers(db); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&User{}, &OauthToken{}, &Session{}, &AuthTransaction{}); err != nil {
+		return fmt.Errorf("failed to migrate: %w", err)
+	}
+
+	return nil
+}
+
+// migrateIdProviders はid_providerに整数で保存されたIdPを名前に置き換える
+//
+// 置き換えた後の値は整数ではなくなるので、何度実行してもよい。
+// 整数の列に文字列を入れられるSQLiteを前提にしている
+func migrateIdProviders(db *gorm.DB, genericProvider string) error {
+	for _, table := range idProviderTables {
+		if !db.Migrator().HasTable(table) {
+			continue
+		}
+
+		for legacy, name := range legacyIdProviders {
+			if err := updateIdProvider(db, table, legacy, name); err != nil {
+				return err
+			}
+		}
+
+		var count int64
+		err := db.Table(table).Where("CAST(id_provider AS TEXT) = ?", legacyGenericIdProvider).Count(&count).Error
+		if err != nil {
+			return fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		if count == 0 {
+			continue
+		}
+		if genericProvider == "" {
+			return fmt.Errorf("%w: set LEGACY_GENERIC_PROVIDER to migrate %s", errLegacyGenericProvider, table)
+		}
+		if err := updateIdProvider(db, table, legacyGenericIdProvider, genericProvider); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func updateIdProvider(db *gorm.DB, table string, legacy string, name string) error {
+	err := db.Table(table).Where("CAST(id_provider AS TEXT) = ?", legacy).UpdateColumn("id_provider", name).Error
+	if err != nil {
+		return fmt.Errorf("failed to migrate id_provider of %s: %w", table, err)
+	}
+
+	return nil
+}
+
+// mergeDuplicateUsers は同じIdPの同じユーザー(id_providerとsubが同じ)として重複して作成されたユーザーを1人にまとめる
+//
+// 削除されていないユーザーのうちidが最も小さいものを残し、トークンとセッションをそのユーザーに付け替えてから残りを削除する。
+// 付け替えで重複したトークンは最も新しいものだけを残す。論理削除したユーザーも一意インデックスの対象になるので物理削除する
+func mergeDuplicateUsers(db *gorm.DB) error {
+	if !db.Migrator().HasTable("users") {
+		return nil
+	}
+
+	var duplicates []struct {
+		IdProvider string
+		Sub        string
+	}
+	err := db.Table("users").
+		Select("id_provider, sub").
+		Group("id_provider, sub").
+		Having("COUNT(*) > 1").
+		Scan(&duplicates).Error
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate users: %w", err)
+	}
+
+	for _, v := range duplicates {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return mergeUsers(tx, v.IdProvider, v.Sub)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mergeUsers(tx *gorm.DB, idProvider string, sub string) error {
+	var ids []uint
+	err := tx.Table("users").
+		Where("id_provider = ? AND sub = ?", idProvider, sub).
+		Order("deleted_at IS NOT NULL, id").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate users: %w", err)
+	}
+	if len(ids) < 2 {
+		return nil
+	}
+	keep, others := ids[0], ids[1:]
+
+	for _, table := range userIdTables {
+		if !tx.Migrator().HasTable(table) {
+			continue
+		}
+		if err := tx.Table(table).Where("user_id IN ?", others).UpdateColumn("user_id", keep).Error; err != nil {
+			return fmt.Errorf("failed to reassign %s: %w", table, err)
+		}
+	}
+	if err := tx.Exec("DELETE FROM users WHERE id IN ?", others).Error; err != nil {
+		return fmt.Errorf("failed to delete duplicate users: %w", err)
+	}
+	if tx.Migrator().HasTable("oauth_tokens") {
+		return dedupeOauthTokens(tx, keep)
+	}
+
+	return nil
+}
+
+// dedupeOauthTokens はトークンを付け替えたことで同じIdPのトークンが複数になった場合に、最も新しいものだけを残す
+//
+// ログインのたびに更新されるのはユーザーとIdPごとに1つのトークンだけなので、古いものは物理削除する
+func dedupeOauthTokens(tx *gorm.DB, userId uint) error {
+	var tokens []struct {
+		Id         uint
+		IdProvider string
+	}
+	err := tx.Table("oauth_tokens").
+		Select("id, id_provider").
+		Where("user_id = ?", userId).
+		Order("deleted_at IS NOT NULL, updated_at DESC, id DESC").
+		Scan(&tokens).Error
+	if err != nil {
+		return fmt.Errorf("failed to find oauth tokens: %w", err)
+	}
+
+	kept := map[string]bool{}
+	var others []uint
+	for _, v := range tokens {
+		if kept[v.IdProvider] {
+			others = append(others, v.Id)
+
+			continue
+		}
+		kept[v.IdProvider] = true
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM oauth_tokens WHERE id IN ?", others).Error; err != nil {
+		return fmt.Errorf("failed to delete duplicate oauth tokens: %w", err)
+	}
+
+	return nil
+}
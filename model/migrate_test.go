@@ -0,0 +1,108 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// createLegacyTables はIdProviderを整数で保存していたときのテーブルを作る
+func createLegacyTables(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	statements := []string{
+		"CREATE TABLE users (id integer PRIMARY KEY AUTOINCREMENT, created_at datetime, updated_at datetime," +
+			" deleted_at datetime, email text, name text, sub text, id_provider integer)",
+		"CREATE TABLE oauth_tokens (id integer PRIMARY KEY AUTOINCREMENT, created_at datetime, updated_at datetime," +
+			" deleted_at datetime, user_id integer, id_provider integer, access_token text, refresh_token text," +
+			" token_type text, expiry datetime)",
+	}
+	for _, v := range statements {
+		if err := db.Exec(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrate_LegacyIdProvider(t *testing.T) {
+	patterns := []struct {
+		desc            string
+		genericProvider string
+		idProviders     []int
+		expected        []string
+		expectedErr     error
+	}{
+		{"組み込みのIdP", "", []int{1, 6}, []string{"google", "yahoo_japan"}, nil},
+		{"設定ファイルのIdP", "keycloak", []int{4, 7}, []string{"github", "keycloak"}, nil},
+		{"設定ファイルのIdPの名前がわからない", "", []int{1, 7}, nil, errLegacyGenericProvider},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			db := newTestDb(t)
+			createLegacyTables(t, db)
+			for i, v := range pattern.idProviders {
+				db.Exec("INSERT INTO users (sub, id_provider) VALUES (?, ?)", "sub", v)
+				db.Exec("INSERT INTO oauth_tokens (user_id, id_provider) VALUES (?, ?)", i+1, v)
+			}
+
+			err := migrateIdProviders(db, pattern.genericProvider)
+			if pattern.expectedErr != nil {
+				assert.ErrorIs(t, err, pattern.expectedErr)
+
+				return
+			}
+			assert.Nil(t, err)
+			assert.Nil(t, db.AutoMigrate(&User{}, &OauthToken{}))
+
+			var users []User
+			db.Order("id").Find(&users)
+			var tokens []OauthToken
+			db.Order("id").Find(&tokens)
+			if assert.Len(t, users, len(pattern.expected)) && assert.Len(t, tokens, len(pattern.expected)) {
+				for i, v := range pattern.expected {
+					assert.Equal(t, v, users[i].IdProvider)
+					assert.Equal(t, v, tokens[i].IdProvider)
+				}
+			}
+
+			// 変換済みのデータに対してもう一度実行しても変わらない
+			assert.Nil(t, migrateIdProviders(db, ""))
+		})
+	}
+}
+
+func TestMigrate_NewDatabase(t *testing.T) {
+	db := newTestDb(t)
+
+	assert.Nil(t, Migrate(db))
+	assert.True(t, db.Migrator().HasIndex(&User{}, "idx_users_id_provider_sub"))
+}
+
+func TestMigrate_DuplicateUsers(t *testing.T) {
+	db := newTestDb(t)
+	createLegacyTables(t, db)
+	// 1は論理削除済み。1〜3はGoogleの同じユーザー
+	db.Exec("INSERT INTO users (id, sub, id_provider, deleted_at) VALUES (1, 'sub-a', 1, CURRENT_TIMESTAMP)")
+	db.Exec("INSERT INTO users (id, sub, id_provider) VALUES (2, 'sub-a', 1), (3, 'sub-a', 1), (4, 'sub-b', 1)")
+	// 1と3のトークンは2に付け替えると重複するので、更新日時が新しい3のものだけが残る
+	db.Exec("INSERT INTO oauth_tokens (user_id, id_provider, updated_at) VALUES" +
+		" (1, 1, '2022-01-02 00:00:00'), (3, 1, '2022-01-03 00:00:00'), (4, 1, '2022-01-01 00:00:00')")
+
+	assert.Nil(t, Migrate(db))
+	assert.True(t, db.Migrator().HasIndex(&User{}, "idx_users_id_provider_sub"))
+
+	var userIds []uint
+	db.Unscoped().Model(&User{}).Order("id").Pluck("id", &userIds)
+	assert.Equal(t, []uint{2, 4}, userIds)
+
+	var tokens []OauthToken
+	db.Unscoped().Order("id").Find(&tokens)
+	if assert.Len(t, tokens, 2) {
+		assert.Equal(t, uint(2), tokens[0].ID)
+		assert.Equal(t, uint(2), tokens[0].UserId)
+		assert.Equal(t, uint(3), tokens[1].ID)
+		assert.Equal(t, uint(4), tokens[1].UserId)
+	}
+}
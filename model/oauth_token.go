@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OauthToken はログイン時にIdPから受け取ったトークン
+//
+// バックエンドのジョブからユーザーの代わりにIdPのAPIを呼ぶために保存する
+type OauthToken struct {
+	gorm.Model
+	UserId     uint
+	IdProvider string
+	// AccessToken とRefreshToken は暗号化して保存する
+	AccessToken  EncryptedString
+	RefreshToken EncryptedString
+	TokenType    string
+	Expiry       time.Time
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session はログイン中のユーザーのセッション
+//
+// セッションIDはcookieにだけ保存し、DBにはハッシュ値を保存する。DBが漏れてもセッションを乗っ取られないようにするため
+type Session struct {
+	gorm.Model
+	IdHash string `gorm:"uniqueIndex"`
+	UserId uint
+	// ExpiresAt はアクセスがあっても延長しない有効期限
+	ExpiresAt time.Time
+	// LastSeenAt は最後にアクセスがあった時刻。アクセスがない期間が長いセッションを無効にするために使う
+	LastSeenAt time.Time
+	IpAddress  string
+	UserAgent  string
+}
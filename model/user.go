@@ -4,17 +4,15 @@ import (
 	"gorm.io/gorm"
 )
 
-//go:generate stringer -type=IdProvider
-type idProvider int
-
-const (
-	Google idProvider = iota + 1
-)
-
 type User struct {
 	gorm.Model
-	Id         int64
-	Email      string
-	Sub        string
-	IdProvider idProvider
+	Email string
+	// Name はIdPから得たユーザーの名前。Appleは初回の認可時にしか送ってこない
+	Name string
+	// Sub はIdP内でのユーザー識別子。Microsoftの場合はtidとoidの組
+	Sub string `gorm:"uniqueIndex:idx_users_id_provider_sub"`
+	// IdProvider はgoogleやgithubのような、ログインに使ったIdPの名前。handler.Provider.Nameと同じ値
+	//
+	// 同じIdPの同じユーザーが重複して作成されないように、Subとの組で一意にする
+	IdProvider string `gorm:"uniqueIndex:idx_users_id_provider_sub"`
 }
@@ -0,0 +1,166 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	// crypto.SHA256などをcrypto.Hash.New()で使えるように登録する
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	errAlgNone         = errors.New("id_token alg none is not allowed")
+	errAlgSymmetric    = errors.New("id_token signed with HMAC is not allowed for asymmetric issuers")
+	errAlgUnsupported  = errors.New("id_token alg unsupported")
+	errAlgNotAllowed   = errors.New("id_token alg not allowed for this client")
+	errAlgKeyMismatch  = errors.New("id_token alg does not match jwk")
+	errInvalidSigLen   = errors.New("invalid signature length")
+	errInvalidSig      = errors.New("invalid signature")
+	errUnexpectedKeyTy = errors.New("unexpected public key type")
+)
+
+// algorithm はJWSのalgと、その検証方法の組
+//
+// refs: https://www.rfc-editor.org/rfc/rfc7518#section-3.1
+type algorithm struct {
+	name string
+	kty  string
+	// crv はEC/OKPの場合に鍵に求めるcurve
+	crv  string
+	hash crypto.Hash
+	// verify はsigningInput(header.payload)に対する署名を検証する
+	verify func(pubKey crypto.PublicKey, signingInput []byte, signature []byte) error
+}
+
+// supportedAlgorithms は検証に対応している非対称鍵のアルゴリズム。noneとHMAC(HS256など)は意図的に含めない
+var supportedAlgorithms = map[string]algorithm{}
+
+func init() {
+	for _, alg := range []algorithm{
+		{name: "RS256", kty: "RSA", hash: crypto.SHA256},
+		{name: "RS384", kty: "RSA", hash: crypto.SHA384},
+		{name: "RS512", kty: "RSA", hash: crypto.SHA512},
+	} {
+		alg.verify = verifyPKCS1v15(alg.hash)
+		supportedAlgorithms[alg.name] = alg
+	}
+
+	for _, alg := range []algorithm{
+		{name: "PS256", kty: "RSA", hash: crypto.SHA256},
+		{name: "PS384", kty: "RSA", hash: crypto.SHA384},
+		{name: "PS512", kty: "RSA", hash: crypto.SHA512},
+	} {
+		alg.verify = verifyPSS(alg.hash)
+		supportedAlgorithms[alg.name] = alg
+	}
+
+	for _, alg := range []algorithm{
+		{name: "ES256", kty: "EC", crv: "P-256", hash: crypto.SHA256},
+		{name: "ES384", kty: "EC", crv: "P-384", hash: crypto.SHA384},
+		{name: "ES512", kty: "EC", crv: "P-521", hash: crypto.SHA512},
+	} {
+		alg.verify = verifyECDSA(alg.hash)
+		supportedAlgorithms[alg.name] = alg
+	}
+
+	supportedAlgorithms["EdDSA"] = algorithm{name: "EdDSA", kty: "OKP", crv: "Ed25519", verify: verifyEd25519}
+}
+
+// findAlgorithm はheaderのalgに対応するalgorithmを返す
+//
+// noneやHMACは常に拒否し、allowedAlgsが空でなければそれに含まれるものだけを受け入れる
+func findAlgorithm(name string, allowedAlgs []string) (algorithm, error) {
+	if strings.EqualFold(name, "none") || name == "" {
+		return algorithm{}, errAlgNone
+	}
+	if strings.HasPrefix(name, "HS") {
+		return algorithm{}, fmt.Errorf("%w: %s", errAlgSymmetric, name)
+	}
+
+	alg, ok := supportedAlgorithms[name]
+	if !ok {
+		return algorithm{}, fmt.Errorf("%w: %s", errAlgUnsupported, name)
+	}
+
+	if len(allowedAlgs) == 0 {
+		return alg, nil
+	}
+	for _, allowed := range allowedAlgs {
+		if allowed == name {
+			return alg, nil
+		}
+	}
+
+	return algorithm{}, fmt.Errorf("%w: %s", errAlgNotAllowed, name)
+}
+
+func digest(hash crypto.Hash, signingInput []byte) []byte {
+	h := hash.New()
+	h.Write(signingInput)
+
+	return h.Sum(nil)
+}
+
+func verifyPKCS1v15(hash crypto.Hash) func(crypto.PublicKey, []byte, []byte) error {
+	return func(pubKey crypto.PublicKey, signingInput []byte, signature []byte) error {
+		rsaKey, ok := pubKey.(*rsa.PublicKey)
+		if !ok {
+			return errUnexpectedKeyTy
+		}
+
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest(hash, signingInput), signature)
+	}
+}
+
+func verifyPSS(hash crypto.Hash) func(crypto.PublicKey, []byte, []byte) error {
+	return func(pubKey crypto.PublicKey, signingInput []byte, signature []byte) error {
+		rsaKey, ok := pubKey.(*rsa.PublicKey)
+		if !ok {
+			return errUnexpectedKeyTy
+		}
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+
+		return rsa.VerifyPSS(rsaKey, hash, digest(hash, signingInput), signature, opts)
+	}
+}
+
+// verifyECDSA はJWSの形式(rとsを固定長で連結したもの)のECDSA署名を検証する
+func verifyECDSA(hash crypto.Hash) func(crypto.PublicKey, []byte, []byte) error {
+	return func(pubKey crypto.PublicKey, signingInput []byte, signature []byte) error {
+		ecKey, ok := pubKey.(*ecdsa.PublicKey)
+		if !ok {
+			return errUnexpectedKeyTy
+		}
+
+		const bitsPerByte = 8
+		keySize := (ecKey.Curve.Params().BitSize + bitsPerByte - 1) / bitsPerByte
+		if len(signature) != 2*keySize {
+			return errInvalidSigLen
+		}
+		r := new(big.Int).SetBytes(signature[:keySize])
+		s := new(big.Int).SetBytes(signature[keySize:])
+		if !ecdsa.Verify(ecKey, digest(hash, signingInput), r, s) {
+			return errInvalidSig
+		}
+
+		return nil
+	}
+}
+
+func verifyEd25519(pubKey crypto.PublicKey, signingInput []byte, signature []byte) error {
+	edKey, ok := pubKey.(ed25519.PublicKey)
+	if !ok {
+		return errUnexpectedKeyTy
+	}
+	if !ed25519.Verify(edKey, signingInput, signature) {
+		return errInvalidSig
+	}
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testSigner はテスト用にJWTへ署名するための鍵とJWKの組
+type testSigner struct {
+	alg  string
+	jwk  jwk
+	sign func(signingInput []byte) []byte
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newTestRsaSigner(t *testing.T, alg string, kid string, pss bool, hash crypto.Hash) testSigner {
+	t.Helper()
+
+	const bits = 2048
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testSigner{
+		alg: alg,
+		jwk: jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Alg: alg,
+			Use: "sig",
+			N:   b64(priv.N.Bytes()),
+			E:   b64(big.NewInt(int64(priv.E)).Bytes()),
+		},
+		sign: func(signingInput []byte) []byte {
+			var sig []byte
+			if pss {
+				opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+				sig, err = rsa.SignPSS(rand.Reader, priv, hash, digest(hash, signingInput), opts)
+			} else {
+				sig, err = rsa.SignPKCS1v15(rand.Reader, priv, hash, digest(hash, signingInput))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return sig
+		},
+	}
+}
+
+func newTestEcdsaSigner(t *testing.T, alg string, kid string, curve elliptic.Curve, crv string, hash crypto.Hash) testSigner {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySize := (curve.Params().BitSize + 7) / 8
+
+	return testSigner{
+		alg: alg,
+		jwk: jwk{
+			Kty: "EC",
+			Kid: kid,
+			Crv: crv,
+			X:   b64(priv.X.FillBytes(make([]byte, keySize))),
+			Y:   b64(priv.Y.FillBytes(make([]byte, keySize))),
+		},
+		sign: func(signingInput []byte) []byte {
+			r, s, err := ecdsa.Sign(rand.Reader, priv, digest(hash, signingInput))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return append(r.FillBytes(make([]byte, keySize)), s.FillBytes(make([]byte, keySize))...)
+		},
+	}
+}
+
+func newTestEd25519Signer(t *testing.T, kid string) testSigner {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testSigner{
+		alg: "EdDSA",
+		jwk: jwk{Kty: "OKP", Kid: kid, Crv: "Ed25519", X: b64(pub)},
+		sign: func(signingInput []byte) []byte {
+			return ed25519.Sign(priv, signingInput)
+		},
+	}
+}
+
+// signTestJwt はheaderのalgとkidを指定してpayloadに署名したJWTの文字列を返す
+func signTestJwt(t *testing.T, signer testSigner, alg string, payload string) string {
+	t.Helper()
+
+	header := fmt.Sprintf(`{"alg": "%s", "kid": "%s", "typ": "JWT"}`, alg, signer.jwk.Kid)
+	signingInput := b64([]byte(header)) + "." + b64([]byte(payload))
+
+	return signingInput + "." + b64(signer.sign([]byte(signingInput)))
+}
+
+// signedTestToken はheaderのalgとkidを指定してpayloadに署名したJWTを返す
+func signedTestToken(t *testing.T, signer testSigner, alg string, payload string) *idToken {
+	t.Helper()
+
+	token, err := NewIdToken(signTestJwt(t, signer, alg, payload), Google)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func newTestJwksServer(t *testing.T, keys ...jwk) *httptest.Server {
+	t.Helper()
+
+	body, err := json.Marshal(jwks{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+}
+
+func TestIdToken_ValidateSignature_Algorithms(t *testing.T) {
+	signers := []testSigner{
+		newTestRsaSigner(t, "RS256", "rs256", false, crypto.SHA256),
+		newTestRsaSigner(t, "RS384", "rs384", false, crypto.SHA384),
+		newTestRsaSigner(t, "RS512", "rs512", false, crypto.SHA512),
+		newTestRsaSigner(t, "PS256", "ps256", true, crypto.SHA256),
+		newTestRsaSigner(t, "PS384", "ps384", true, crypto.SHA384),
+		newTestRsaSigner(t, "PS512", "ps512", true, crypto.SHA512),
+		newTestEcdsaSigner(t, "ES256", "es256", elliptic.P256(), "P-256", crypto.SHA256),
+		newTestEcdsaSigner(t, "ES384", "es384", elliptic.P384(), "P-384", crypto.SHA384),
+		newTestEcdsaSigner(t, "ES512", "es512", elliptic.P521(), "P-521", crypto.SHA512),
+		newTestEd25519Signer(t, "eddsa"),
+	}
+	keys := make([]jwk, 0, len(signers))
+	for _, signer := range signers {
+		keys = append(keys, signer.jwk)
+	}
+	server := newTestJwksServer(t, keys...)
+	defer server.Close()
+
+	for _, signer := range signers {
+		token := signedTestToken(t, signer, signer.alg, "{}")
+		assert.Nil(t, token.validateSignature(server.URL, nil), signer.alg)
+
+		// payloadを改竄すると検証に失敗する
+		token.RawPayload = b64([]byte(`{"sub": "attacker"}`))
+		assert.Error(t, token.validateSignature(server.URL, nil), signer.alg)
+	}
+}
+
+func TestIdToken_ValidateSignature_Rejects(t *testing.T) {
+	rsaSigner := newTestRsaSigner(t, "RS256", "rs256", false, crypto.SHA256)
+	ecSigner := newTestEcdsaSigner(t, "ES256", "es256", elliptic.P256(), "P-256", crypto.SHA256)
+	server := newTestJwksServer(t, rsaSigner.jwk, ecSigner.jwk)
+	defer server.Close()
+
+	patterns := []struct {
+		desc        string
+		token       *idToken
+		allowedAlgs []string
+		expected    error
+	}{
+		{
+			"alg none",
+			func() *idToken {
+				token := signedTestToken(t, rsaSigner, "none", "{}")
+				token.rawSignature = ""
+
+				return token
+			}(),
+			nil,
+			errAlgNone,
+		},
+		{
+			"HMAC",
+			signedTestToken(t, rsaSigner, "HS256", "{}"),
+			nil,
+			errAlgSymmetric,
+		},
+		{
+			"未対応のalg",
+			signedTestToken(t, rsaSigner, "RS1", "{}"),
+			nil,
+			errAlgUnsupported,
+		},
+		{
+			"allow-listにないalg",
+			signedTestToken(t, ecSigner, "ES256", "{}"),
+			[]string{"RS256"},
+			errAlgNotAllowed,
+		},
+		{
+			"鍵のalgとheaderのalgが一致しない",
+			signedTestToken(t, rsaSigner, "PS256", "{}"),
+			nil,
+			errAlgKeyMismatch,
+		},
+		{
+			"RSAの鍵にESのalg",
+			signedTestToken(t, rsaSigner, "ES256", "{}"),
+			nil,
+			errAlgKeyMismatch,
+		},
+	}
+
+	for _, pattern := range patterns {
+		err := pattern.token.validateSignature(server.URL, pattern.allowedAlgs)
+		assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+	}
+}
+
+func TestJwk_RsaPublicKey(t *testing.T) {
+	patterns := []struct {
+		desc          string
+		isExpectValid bool
+		e             string
+		expected      int
+	}{
+		{"AQAB", true, "AQAB", 65537},
+		{"e=3", true, "Aw", 3},
+		{"e=1", false, "AQ", 0},
+		{"空のe", false, "", 0},
+		{"base64ではない", false, "!!", 0},
+	}
+
+	for _, pattern := range patterns {
+		key := jwk{Kty: "RSA", N: b64([]byte{0xc3, 0x5f}), E: pattern.e}
+		pubKey, err := key.rsaPublicKey()
+		if pattern.isExpectValid {
+			assert.Nil(t, err, pattern.desc)
+			assert.Equal(t, pattern.expected, pubKey.E, pattern.desc)
+		} else {
+			assert.Error(t, err, pattern.desc)
+		}
+	}
+}
+
+func TestFindAlgorithm(t *testing.T) {
+	for _, name := range []string{"none", "None", "NONE", ""} {
+		_, err := findAlgorithm(name, nil)
+		assert.ErrorIs(t, err, errAlgNone, name)
+	}
+
+	for _, name := range []string{"HS256", "HS384", "HS512"} {
+		_, err := findAlgorithm(name, []string{name})
+		assert.ErrorIs(t, err, errAlgSymmetric, name)
+	}
+
+	alg, err := findAlgorithm("EdDSA", []string{"RS256", "EdDSA"})
+	assert.Nil(t, err)
+	assert.Equal(t, "OKP", alg.kty)
+	assert.True(t, strings.HasPrefix(alg.crv, "Ed"))
+}
@@ -0,0 +1,290 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// refs: https://developer.apple.com/documentation/sign_in_with_apple/sign_in_with_apple_rest_api
+const appleIssuer = "https://appleid.apple.com"
+
+const (
+	// appleClientSecretLifetime はclient_secretとして使うJWTの有効期間。Appleの上限は6ヶ月(15777000秒)
+	appleClientSecretLifetime = 30 * 24 * time.Hour
+	// appleClientSecretRenewBefore は有効期限のこの時間前にclient_secretを作り直す
+	appleClientSecretRenewBefore = 24 * time.Hour
+)
+
+// real_user_statusの値。Appleがユーザーを実在の人物だと判断しているかを表す
+//
+// refs: https://developer.apple.com/documentation/authenticationservices/asuserdetectionstatus
+const (
+	AppleRealUserStatusUnsupported = 0
+	AppleRealUserStatusUnknown     = 1
+	AppleRealUserStatusLikelyReal  = 2
+)
+
+var (
+	errAppleConfigMissing = errors.New("apple client configuration missing")
+	errInvalidAppleKey    = errors.New("invalid apple private key")
+)
+
+// NewAppleOidcClient はSign in with Appleのクライアントを返す
+//
+// APPLE_CLIENT_IDにはServices ID、APPLE_PRIVATE_KEY_PATHにはApple Developerでダウンロードした.p8ファイルのパスを設定する
+func NewAppleOidcClient() (*oidcClient, error) {
+	keyPath := os.Getenv("APPLE_PRIVATE_KEY_PATH")
+	if keyPath == "" {
+		return nil, fmt.Errorf("%w: APPLE_PRIVATE_KEY_PATH", errAppleConfigMissing)
+	}
+	bKey, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read apple private key: %w", err)
+	}
+	key, err := parseApplePrivateKey(bKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAppleOidcClient(
+		os.Getenv("APPLE_CLIENT_ID"),
+		os.Getenv("APPLE_TEAM_ID"),
+		os.Getenv("APPLE_KEY_ID"),
+		key,
+	)
+}
+
+func newAppleOidcClient(clientId, teamId, keyId string, key *ecdsa.PrivateKey) (*oidcClient, error) {
+	for name, v := range map[string]string{"client id": clientId, "team id": teamId, "key id": keyId} {
+		if v == "" {
+			return nil, fmt.Errorf("%w: %s", errAppleConfigMissing, name)
+		}
+	}
+
+	client := newOidcClient(
+		Apple,
+		clientId,
+		"",
+		appleIssuer+"/auth/authorize",
+		appleIssuer+"/auth/token",
+		appleIssuer+"/auth/keys",
+	)
+	client.Issuer = appleIssuer
+	client.revocationEndpoint = appleIssuer + "/auth/revoke"
+	// refs: https://appleid.apple.com/.well-known/openid-configuration
+	client.allowedAlgs = []string{"RS256"}
+	client.clientAuth = &appleClientSecretAuth{
+		clientId: clientId,
+		teamId:   teamId,
+		keyId:    keyId,
+		key:      key,
+		now:      time.Now,
+	}
+
+	return client, nil
+}
+
+// parseApplePrivateKey は.p8ファイル(PKCS#8のPEM)からP-256の秘密鍵を取り出す
+func parseApplePrivateKey(bKey []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(bKey)
+	if block == nil {
+		return nil, fmt.Errorf("%w: not PEM", errInvalidAppleKey)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidAppleKey, err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: not P-256 ECDSA key", errInvalidAppleKey)
+	}
+
+	return key, nil
+}
+
+// appleClientSecretAuth は.p8の鍵でES256署名したJWTをclient_secretとして送る
+//
+// Appleのclient_secretはclient_assertionとは違い長期間使えるので、有効期限が近づくまで使い回す
+type appleClientSecretAuth struct {
+	clientId string
+	teamId   string
+	keyId    string
+	key      *ecdsa.PrivateKey
+	now      func() time.Time
+
+	mu        sync.Mutex
+	secret    string
+	expiresAt time.Time
+}
+
+func (a *appleClientSecretAuth) authenticate(values url.Values, _ http.Header, _ string) error {
+	secret, err := a.clientSecret()
+	if err != nil {
+		return err
+	}
+	values.Set("client_id", a.clientId)
+	values.Set("client_secret", secret)
+
+	return nil
+}
+
+// clientSecret は有効なclient_secretを返す。有効期限が近い場合は作り直す
+func (a *appleClientSecretAuth) clientSecret() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if a.secret != "" && now.Add(appleClientSecretRenewBefore).Before(a.expiresAt) {
+		return a.secret, nil
+	}
+
+	expiresAt := now.Add(appleClientSecretLifetime)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+		Issuer:    a.teamId,
+		Subject:   a.clientId,
+		Audience:  appleIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	token.Header["kid"] = a.keyId
+	secret, err := token.SignedString(a.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign apple client_secret: %w", err)
+	}
+	a.secret = secret
+	a.expiresAt = expiresAt
+
+	return secret, nil
+}
+
+// String は秘密鍵と生成したclient_secretがログに出力されないようにマスクする
+func (a *appleClientSecretAuth) String() string {
+	return fmt.Sprintf("apple_client_secret(client_id=%s, kid=%s, key=%s)", a.clientId, a.keyId, secretMaskingStr)
+}
+
+// GoString は秘密鍵と生成したclient_secretがログに出力されないようにマスクする
+func (a *appleClientSecretAuth) GoString() string {
+	return a.String()
+}
+
+// WithResponseMode は認可レスポンスの返し方(response_mode)を付与する
+//
+// Appleでnameやemailのスコープを要求する場合はform_postが必須
+func WithResponseMode(mode string) AuthOption {
+	return func(values url.Values) {
+		values.Set("response_mode", mode)
+	}
+}
+
+// appleBool はAppleが"true"のような文字列で返すことがある真偽値をunmarshalする
+type appleBool bool
+
+func (b *appleBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case bool:
+		*b = appleBool(t)
+	case string:
+		parsed, err := strconv.ParseBool(t)
+		if err != nil {
+			return fmt.Errorf("invalid boolean string: %s", t)
+		}
+		*b = appleBool(parsed)
+	case nil:
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean: %s", string(data))
+	}
+
+	return nil
+}
+
+// appleIdTokenPayload はAppleのid_tokenのpayloadをunmarshalするための構造体
+//
+// refs: https://developer.apple.com/documentation/sign_in_with_apple/sign_in_with_apple_rest_api/authenticating_users_with_sign_in_with_apple
+type appleIdTokenPayload struct {
+	StandardClaims
+	// AppleEmailVerified はStandardClaims.EmailVerifiedの代わりにunmarshalされる
+	AppleEmailVerified appleBool `json:"email_verified"`
+	// IsPrivateEmail はメールアドレスがAppleのリレーサービスのものかどうか
+	IsPrivateEmail appleBool `json:"is_private_email"`
+	// RealUserStatus はAppleRealUserStatusUnsupportedなどの値
+	RealUserStatus int `json:"real_user_status"`
+}
+
+// GetClaims は文字列で返されたemail_verifiedを反映したクレームを返す
+func (payload appleIdTokenPayload) GetClaims() StandardClaims {
+	claims := payload.StandardClaims
+	claims.EmailVerified = bool(payload.AppleEmailVerified)
+
+	return claims
+}
+
+// AppleIdentity はAppleのid_tokenから得たユーザーの情報
+type AppleIdentity struct {
+	// IsPrivateEmail はメールアドレスがAppleのリレーサービスのものかどうか
+	IsPrivateEmail bool
+	// RealUserStatus はAppleRealUserStatusUnsupportedなどの値
+	RealUserStatus int
+}
+
+// extendIdentity はis_private_emailとreal_user_statusをIdentityのAppleにセットする
+func (payload appleIdTokenPayload) extendIdentity(identity *Identity) {
+	identity.Apple = AppleIdentity{
+		IsPrivateEmail: bool(payload.IsPrivateEmail),
+		RealUserStatus: payload.RealUserStatus,
+	}
+}
+
+// AppleUser はAppleが初回の認可時にのみフォームのuserパラメータで送ってくるユーザー情報
+//
+// id_tokenには名前が含まれないので、初回に受け取った名前を保存しておく必要がある
+type AppleUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+	Email string `json:"email"`
+}
+
+// ParseAppleUser はフォームのuserパラメータをパースする。送られてこなかった場合はゼロ値を返す
+func ParseAppleUser(raw string) (AppleUser, error) {
+	user := AppleUser{}
+	if raw == "" {
+		return user, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &user); err != nil {
+		return AppleUser{}, fmt.Errorf("failed to unmarshal apple user: %w", err)
+	}
+
+	return user, nil
+}
+
+// FullName は姓名をつなげた名前を返す
+func (u AppleUser) FullName() string {
+	switch {
+	case u.Name.FirstName == "":
+		return u.Name.LastName
+	case u.Name.LastName == "":
+		return u.Name.FirstName
+	default:
+		return u.Name.FirstName + " " + u.Name.LastName
+	}
+}
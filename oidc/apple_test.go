@@ -0,0 +1,233 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAppleClient(t *testing.T) (*oidcClient, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := newAppleOidcClient("com.example.service", "TEAMID1234", "KEYID12345", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, key
+}
+
+func TestParseApplePrivateKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	bKey, _ := x509.MarshalPKCS8PrivateKey(key)
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	bP384Key, _ := x509.MarshalPKCS8PrivateKey(p384Key)
+
+	patterns := []struct {
+		desc          string
+		isExpectValid bool
+		pem           []byte
+	}{
+		{"P-256のPKCS#8", true, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: bKey})},
+		{"P-384の鍵", false, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: bP384Key})},
+		{"PEMではない", false, []byte("not pem")},
+	}
+
+	for _, pattern := range patterns {
+		parsed, err := parseApplePrivateKey(pattern.pem)
+		if pattern.isExpectValid {
+			assert.Nil(t, err, pattern.desc)
+			assert.True(t, key.Equal(parsed), pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, errInvalidAppleKey, pattern.desc)
+		}
+	}
+}
+
+func TestNewAppleOidcClient_ConfigMissing(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	_, err := newAppleOidcClient("com.example.service", "", "KEYID12345", key)
+	assert.ErrorIs(t, err, errAppleConfigMissing)
+}
+
+func TestAppleClientSecretAuth(t *testing.T) {
+	client, key := newTestAppleClient(t)
+	auth := client.clientAuth.(*appleClientSecretAuth)
+	now := time.Now()
+	auth.now = func() time.Time { return now }
+
+	values := url.Values{}
+	assert.Nil(t, auth.authenticate(values, http.Header{}, client.tokenEndpoint))
+	assert.Equal(t, "com.example.service", values.Get("client_id"))
+
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(values.Get("client_secret"), claims, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "ES256", token.Header["alg"])
+	assert.Equal(t, "KEYID12345", token.Header["kid"])
+	assert.Equal(t, "TEAMID1234", claims.Issuer)
+	assert.Equal(t, "com.example.service", claims.Subject)
+	assert.Equal(t, appleIssuer, claims.Audience)
+	assert.Equal(t, now.Add(appleClientSecretLifetime).Unix(), claims.ExpiresAt)
+
+	// 秘密鍵はログに出力されない
+	assert.NotContains(t, fmt.Sprintf("%v %#v", auth, auth), "PrivateKey")
+
+	patterns := []struct {
+		desc        string
+		elapsed     time.Duration
+		isExpectNew bool
+	}{
+		{"有効期限まで余裕がある場合は使い回す", appleClientSecretLifetime - appleClientSecretRenewBefore - time.Minute, false},
+		{"有効期限が近い場合は作り直す", appleClientSecretLifetime - appleClientSecretRenewBefore, true},
+	}
+
+	for _, pattern := range patterns {
+		auth.secret = values.Get("client_secret")
+		auth.expiresAt = now.Add(appleClientSecretLifetime)
+		auth.now = func() time.Time { return now.Add(pattern.elapsed) }
+
+		secret, err := auth.clientSecret()
+		assert.Nil(t, err, pattern.desc)
+		assert.Equal(t, pattern.isExpectNew, secret != values.Get("client_secret"), pattern.desc)
+	}
+}
+
+func TestNewIdToken_Apple(t *testing.T) {
+	patterns := []struct {
+		desc                  string
+		payload               string
+		expectedEmailVerified bool
+		expectedPrivateEmail  bool
+	}{
+		{
+			"真偽値が文字列",
+			`{"sub": "001.abc", "email": "x@privaterelay.appleid.com",
+  "email_verified": "true", "is_private_email": "true", "real_user_status": 2}`,
+			true,
+			true,
+		},
+		{
+			"真偽値がbool",
+			`{"sub": "001.abc", "email": "jane@example.com",
+  "email_verified": true, "is_private_email": false, "real_user_status": 2}`,
+			true,
+			false,
+		},
+		{
+			"省略",
+			`{"sub": "001.abc"}`,
+			false,
+			false,
+		},
+	}
+
+	for _, pattern := range patterns {
+		rawToken := b64([]byte(`{"alg": "RS256", "kid": "kid1"}`)) + "." + b64([]byte(pattern.payload)) + ".sig"
+		token, err := NewIdToken(rawToken, Apple)
+		assert.Nil(t, err, pattern.desc)
+
+		payload := token.Payload.(*appleIdTokenPayload)
+		assert.Equal(t, pattern.expectedEmailVerified, token.Payload.GetClaims().EmailVerified, pattern.desc)
+		assert.Equal(t, pattern.expectedPrivateEmail, bool(payload.IsPrivateEmail), pattern.desc)
+	}
+
+	rawToken := b64([]byte(`{"alg": "RS256"}`)) + "." + b64([]byte(`{"real_user_status": 2}`)) + ".sig"
+	token, err := NewIdToken(rawToken, Apple)
+	assert.Nil(t, err)
+	var identity Identity
+	token.Payload.(identityExtender).extendIdentity(&identity)
+	assert.Equal(t, AppleRealUserStatusLikelyReal, identity.Apple.RealUserStatus)
+}
+
+func TestParseAppleUser(t *testing.T) {
+	patterns := []struct {
+		desc         string
+		raw          string
+		expectedName string
+	}{
+		{"初回の認可", `{"name": {"firstName": "Jane", "lastName": "Doe"}, "email": "jane@example.com"}`, "Jane Doe"},
+		{"姓のみ", `{"name": {"lastName": "Doe"}}`, "Doe"},
+		{"2回目以降は送られてこない", "", ""},
+	}
+
+	for _, pattern := range patterns {
+		user, err := ParseAppleUser(pattern.raw)
+		assert.Nil(t, err, pattern.desc)
+		assert.Equal(t, pattern.expectedName, user.FullName(), pattern.desc)
+	}
+
+	_, err := ParseAppleUser("{")
+	assert.Error(t, err)
+}
+
+func TestOidcClient_Exchange_Apple(t *testing.T) {
+	signer := newTestRsaSigner(t, "RS256", "apple", false, crypto.SHA256)
+	jwksServer := newTestJwksServer(t, signer.jwk)
+	defer jwksServer.Close()
+
+	now := time.Now().Unix()
+	rawToken := signTestJwt(t, signer, "RS256", fmt.Sprintf(`{
+  "iss": "%s",
+  "aud": "com.example.service",
+  "sub": "001.abc",
+  "exp": %d,
+  "iat": %d,
+  "nonce": "nonce-value",
+  "email": "x@privaterelay.appleid.com",
+  "email_verified": "true",
+  "is_private_email": "true"
+}`, appleIssuer, now+600, now))
+
+	var form url.Values
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token": "at", "refresh_token": "rt", "expires_in": 3600, "id_token": "%s"}`,
+			rawToken)
+	}))
+	defer tokenServer.Close()
+
+	client, _ := newTestAppleClient(t)
+	client.tokenEndpoint = tokenServer.URL
+	client.JwksEndpoint = jwksServer.URL
+
+	verifier, _ := RandomCodeVerifier()
+	identity, err := client.Exchange(context.Background(), "code", "https://rp.example.com/cb", verifier, "nonce-value")
+	assert.Nil(t, err)
+	assert.Equal(t, Apple, identity.IdProvider)
+	assert.Equal(t, "001.abc", identity.Subject)
+	assert.Equal(t, "x@privaterelay.appleid.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+	assert.Equal(t, "rt", identity.Token.RefreshToken)
+	assert.True(t, identity.Apple.IsPrivateEmail)
+	assert.Equal(t, verifier, form.Get("code_verifier"))
+	assert.NotEmpty(t, form.Get("client_secret"))
+
+	// nonceが一致しない場合は拒否する
+	_, err = client.Exchange(context.Background(), "code", "https://rp.example.com/cb", verifier, "other")
+	assert.ErrorIs(t, err, errNonceMismatch)
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+}
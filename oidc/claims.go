@@ -0,0 +1,134 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultLeeway はIdPとの時計のずれとして許容する時間
+	defaultLeeway = 1 * time.Minute
+	// defaultMaxIatAge はid_tokenの発行(iat)から受け入れるまでに許容する時間
+	defaultMaxIatAge = 10 * time.Minute
+)
+
+var (
+	errAzpMismatch        = errors.New("id_token authorized party mismatch")
+	errIatMissing         = errors.New("id_token iat missing")
+	errIatInFuture        = errors.New("id_token issued in the future")
+	errIatTooOld          = errors.New("id_token issued too long ago")
+	errIdTokenNotYetValid = errors.New("id_token not yet valid")
+	errAuthTimeTooOld     = errors.New("id_token auth_time exceeds max_age")
+	errAcrNotSatisfied    = errors.New("id_token acr not satisfied")
+)
+
+// audience はaudクレーム。OIDCでは文字列と文字列の配列のどちらも許されている
+type audience []string
+
+func (aud *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*aud = audience{single}
+
+		return nil
+	}
+
+	var multi []string
+	if err := json.Unmarshal(b, &multi); err != nil {
+		return fmt.Errorf("failed to unmarshal aud: %w", err)
+	}
+	*aud = multi
+
+	return nil
+}
+
+func (aud audience) contains(clientId string) bool {
+	for _, v := range aud {
+		if v == clientId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timeClaims はid_tokenに含まれる時刻のクレーム。いずれもUNIX時間(秒)
+type timeClaims struct {
+	exp      int64
+	iat      int64
+	nbf      int64
+	authTime int64
+}
+
+// validateAudience はaudにクライアントIDが含まれることと、azpを確認する
+//
+// audが複数ある場合はazpが必須で、azpがある場合はクライアントIDと一致しなければならない
+//
+// refs: https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+func validateAudience(aud audience, azp string, clientId string) error {
+	if !aud.contains(clientId) {
+		return errAudMismatch
+	}
+
+	if len(aud) > 1 && azp == "" {
+		return fmt.Errorf("%w: azp required for multiple audiences", errAzpMismatch)
+	}
+	if azp != "" && azp != clientId {
+		return errAzpMismatch
+	}
+
+	return nil
+}
+
+// validateTimeClaims はexp, iat, nbf, auth_timeを、時計のずれ(leeway)を許容しつつ確認する
+func validateTimeClaims(claims timeClaims, params ValidationParams) error {
+	now := params.now()
+	leeway := params.Leeway
+
+	if now.After(time.Unix(claims.exp, 0).Add(leeway)) {
+		return errIdTokenExpired
+	}
+
+	if claims.iat == 0 {
+		return errIatMissing
+	}
+	iat := time.Unix(claims.iat, 0)
+	if iat.After(now.Add(leeway)) {
+		return errIatInFuture
+	}
+	if params.MaxIatAge > 0 && now.Sub(iat) > params.MaxIatAge+leeway {
+		return errIatTooOld
+	}
+
+	if claims.nbf != 0 && time.Unix(claims.nbf, 0).After(now.Add(leeway)) {
+		return errIdTokenNotYetValid
+	}
+
+	if params.MaxAge > 0 {
+		if claims.authTime == 0 {
+			return fmt.Errorf("%w: auth_time missing", errAuthTimeTooOld)
+		}
+		if now.Sub(time.Unix(claims.authTime, 0)) > params.MaxAge+leeway {
+			return errAuthTimeTooOld
+		}
+	}
+
+	return nil
+}
+
+// validateAcr はacrが認可リクエストで要求したacr_valuesのいずれかであることを確認する
+func validateAcr(acr string, acrValues []string) error {
+	if len(acrValues) == 0 {
+		return nil
+	}
+
+	for _, v := range acrValues {
+		if acr == v {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", errAcrNotSatisfied, acr)
+}
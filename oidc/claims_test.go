@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudience_UnmarshalJSON(t *testing.T) {
+	patterns := []struct {
+		desc          string
+		isExpectValid bool
+		json          string
+		expected      audience
+	}{
+		{"文字列", true, `{"aud": "client-id"}`, audience{"client-id"}},
+		{"配列", true, `{"aud": ["client-id", "other"]}`, audience{"client-id", "other"}},
+		{"数値", false, `{"aud": 1}`, nil},
+	}
+
+	for _, pattern := range patterns {
+		payload := struct {
+			Aud audience `json:"aud"`
+		}{}
+		err := json.Unmarshal([]byte(pattern.json), &payload)
+		if pattern.isExpectValid {
+			assert.Nil(t, err, pattern.desc)
+			assert.Equal(t, pattern.expected, payload.Aud, pattern.desc)
+		} else {
+			assert.Error(t, err, pattern.desc)
+		}
+	}
+}
+
+func TestValidateAudience(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		expected error
+		aud      audience
+		azp      string
+	}{
+		{"単一のaud", nil, audience{"client-id"}, ""},
+		{"azpが一致", nil, audience{"client-id", "other"}, "client-id"},
+		{"audに含まれない", errAudMismatch, audience{"other"}, ""},
+		{"複数のaudでazpがない", errAzpMismatch, audience{"client-id", "other"}, ""},
+		{"azpが一致しない", errAzpMismatch, audience{"client-id", "other"}, "other"},
+	}
+
+	for _, pattern := range patterns {
+		err := validateAudience(pattern.aud, pattern.azp, "client-id")
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+}
+
+func TestValidateTimeClaims(t *testing.T) {
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) int64 {
+		return now.Add(d).Unix()
+	}
+	valid := timeClaims{exp: at(time.Hour), iat: at(-time.Minute)}
+
+	patterns := []struct {
+		desc     string
+		expected error
+		claims   timeClaims
+		maxAge   time.Duration
+	}{
+		{"valid", nil, valid, 0},
+		{"leeway内のexp", nil, timeClaims{exp: at(-30 * time.Second), iat: at(-time.Minute)}, 0},
+		{"exp切れ", errIdTokenExpired, timeClaims{exp: at(-2 * time.Minute), iat: at(-time.Hour)}, 0},
+		{"iatがない", errIatMissing, timeClaims{exp: at(time.Hour)}, 0},
+		{"leeway内の未来のiat", nil, timeClaims{exp: at(time.Hour), iat: at(30 * time.Second)}, 0},
+		{"未来のiat", errIatInFuture, timeClaims{exp: at(time.Hour), iat: at(2 * time.Minute)}, 0},
+		{"古すぎるiat", errIatTooOld, timeClaims{exp: at(time.Hour), iat: at(-time.Hour)}, 0},
+		{"nbf前", errIdTokenNotYetValid, timeClaims{exp: at(time.Hour), iat: at(0), nbf: at(2 * time.Minute)}, 0},
+		{"nbf後", nil, timeClaims{exp: at(time.Hour), iat: at(0), nbf: at(-time.Minute)}, 0},
+		{"max_age内", nil, timeClaims{exp: at(time.Hour), iat: at(0), authTime: at(-4 * time.Minute)}, 5 * time.Minute},
+		{"max_age超過", errAuthTimeTooOld, timeClaims{exp: at(time.Hour), iat: at(0), authTime: at(-7 * time.Minute)}, 5 * time.Minute},
+		{"max_ageを送ったがauth_timeがない", errAuthTimeTooOld, valid, 5 * time.Minute},
+	}
+
+	for _, pattern := range patterns {
+		params := ValidationParams{
+			Leeway:    time.Minute,
+			MaxIatAge: 10 * time.Minute,
+			MaxAge:    pattern.maxAge,
+			Now:       func() time.Time { return now },
+		}
+		err := validateTimeClaims(pattern.claims, params)
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+}
+
+func TestValidateAcr(t *testing.T) {
+	assert.Nil(t, validateAcr("", nil))
+	assert.Nil(t, validateAcr("urn:mace:incommon:iap:silver", []string{"urn:mace:incommon:iap:silver"}))
+	assert.ErrorIs(t, validateAcr("0", []string{"urn:mace:incommon:iap:silver"}), errAcrNotSatisfied)
+}
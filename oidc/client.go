@@ -4,27 +4,53 @@ package oidc
 import (
 	"context"
 	"crypto/rand"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"sns-login/logger"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const httpTimeoutSec = 10
 
+// maxDocumentSize はDiscoveryとJWKsのレスポンスとして読み込む最大バイト数
+const maxDocumentSize = 1 << 20
+
 type oidcClient struct {
 	IdProvider
+	Issuer        string
 	ClientId      string
 	clientSecret  clientSecret
 	authEndpoint  string
 	tokenEndpoint string
 	JwksEndpoint  string
+	// clientAuth はトークンエンドポイントなどでのクライアント認証方式。nilの場合はclient_secret_post
+	clientAuth clientAuthenticator
+	// allowedAlgs はid_tokenの署名として受け入れるアルゴリズム
+	allowedAlgs []string
+	// allowedTenants はMicrosoftのid_tokenで受け入れるテナントID
+	allowedTenants []string
+	// allowedHostedDomains はGoogleのid_tokenで受け入れるWorkspaceのドメイン
+	allowedHostedDomains []string
+	// verifyIdTokenWithSecret はHS256で署名されたid_tokenをclient_secretで検証するかどうか。LINEのみ
+	verifyIdTokenWithSecret bool
+	// claimMapping は設定ファイルから追加したIdPで、ユーザーの識別子などに使うクレーム
+	claimMapping ClaimMapping
+	// 以下はDiscoveryから取得するか、IdPごとのコンストラクタでセットする
+	userinfoEndpoint      string
+	revocationEndpoint    string
+	introspectionEndpoint string
+	// revocationTokenParam は返却するトークンを送るパラメータ名。空の場合はRFC 7009のtoken
+	revocationTokenParam string
+	// refreshTokenNotRevocable はリフレッシュトークンを返却するAPIがないかどうか。LINEのみ
+	refreshTokenNotRevocable bool
+	// introspectionCache はEnableIntrospectionCacheを呼んだ場合のみセットされる
+	introspectionCache *introspectionCache
 }
 
 // tokenResponse はトークンエンドポイントのレスポンスをunmarshalするため構造体
@@ -34,6 +60,8 @@ type tokenResponse struct {
 	Scope       string `json:"scope"`
 	TokenType   string `json:"token_type"`
 	IdToken     string `json:"id_token"`
+	// RefreshToken はaccess_type=offlineなどでオフラインアクセスを要求した場合のみ返される
+	RefreshToken string `json:"refresh_token"`
 }
 
 func newOidcClient(
@@ -55,8 +83,10 @@ func newOidcClient(
 }
 
 // NewGoogleOidcClient はGoogleのクライアントを返す
+//
+// GOOGLE_ALLOWED_HDにカンマ区切りでGoogle Workspaceのドメインを設定すると、それ以外のアカウントのユーザーを拒否する
 func NewGoogleOidcClient() *oidcClient {
-	return newOidcClient(
+	client := newOidcClient(
 		Google,
 		os.Getenv("GOOGLE_CLIENT_ID"),
 		clientSecret(os.Getenv("GOOGLE_CLIENT_SECRET")),
@@ -64,11 +94,126 @@ func NewGoogleOidcClient() *oidcClient {
 		"https://oauth2.googleapis.com/token",
 		"https://www.googleapis.com/oauth2/v3/certs",
 	)
+	client.Issuer = googleIssuers[0]
+	client.userinfoEndpoint = "https://openidconnect.googleapis.com/v1/userinfo"
+	client.revocationEndpoint = "https://oauth2.googleapis.com/revoke"
+	// refs: https://accounts.google.com/.well-known/openid-configuration
+	client.allowedAlgs = []string{"RS256"}
+	if allowed := os.Getenv("GOOGLE_ALLOWED_HD"); allowed != "" {
+		client.SetAllowedHostedDomains(strings.Split(allowed, ","))
+	}
+
+	return client
+}
+
+// SetAllowedHostedDomains はid_tokenで受け入れるGoogle Workspaceのドメイン(hd)を設定する
+func (c *oidcClient) SetAllowedHostedDomains(domains []string) {
+	c.allowedHostedDomains = nil
+	for _, v := range domains {
+		if v = strings.TrimSpace(v); v != "" {
+			c.allowedHostedDomains = append(c.allowedHostedDomains, v)
+		}
+	}
+}
+
+// AllowedHostedDomains はid_tokenで受け入れるGoogle Workspaceのドメインを返す
+func (c oidcClient) AllowedHostedDomains() []string {
+	return c.allowedHostedDomains
+}
+
+// SetAllowedAlgs はid_tokenの署名として受け入れるアルゴリズムを設定する
+func (c *oidcClient) SetAllowedAlgs(algs []string) {
+	c.allowedAlgs = algs
+}
+
+// ValidationParams はこのクライアントでid_tokenを検証するためのパラメータを返す
+func (c oidcClient) ValidationParams() ValidationParams {
+	params := ValidationParams{
+		JwksUrl:        c.JwksEndpoint,
+		Issuer:         c.Issuer,
+		ClientId:       c.ClientId,
+		AllowedAlgs:    c.allowedAlgs,
+		Leeway:         defaultLeeway,
+		MaxIatAge:      defaultMaxIatAge,
+		AllowedTenants: c.allowedTenants,
+		// Google以外のIdPのpayloadでは使わない
+		AllowedHostedDomains: c.allowedHostedDomains,
+	}
+	if c.verifyIdTokenWithSecret {
+		params.SymmetricKey = []byte(c.clientSecret)
+	}
+
+	return params
+}
+
+// AuthOption は認可リクエストにパラメータを追加する
+type AuthOption func(values url.Values)
+
+// WithCodeChallenge はPKCEのcode_challengeをS256方式で付与する
+func WithCodeChallenge(challenge string) AuthOption {
+	return func(values url.Values) {
+		values.Set("code_challenge", challenge)
+		values.Set("code_challenge_method", CodeChallengeMethodS256)
+	}
+}
+
+// WithNonce はid_tokenに含めてもらうnonceを付与する
+func WithNonce(nonce string) AuthOption {
+	return func(values url.Values) {
+		values.Set("nonce", nonce)
+	}
+}
+
+// WithMaxAge は最後にユーザーが認証してから許容する経過時間(max_age)を付与する
+func WithMaxAge(maxAge time.Duration) AuthOption {
+	return func(values url.Values) {
+		values.Set("max_age", strconv.Itoa(int(maxAge.Seconds())))
+	}
+}
+
+// WithAcrValues は要求する認証コンテキストクラス(acr_values)を付与する
+func WithAcrValues(acrValues []string) AuthOption {
+	return func(values url.Values) {
+		values.Set("acr_values", strings.Join(acrValues, " "))
+	}
+}
+
+// WithOfflineAccess はリフレッシュトークンを発行してもらうためにaccess_type=offlineを付与する
+//
+// Googleは初回の同意時にしかリフレッシュトークンを返さないので、prompt=consentで毎回同意画面を出す
+func WithOfflineAccess() AuthOption {
+	return func(values url.Values) {
+		values.Set("access_type", "offline")
+		values.Set("prompt", "consent")
+	}
+}
+
+// WithHostedDomain はGoogleのログイン画面で選べるアカウントを絞り込むためにhdを付与する
+//
+// 許可するドメインが1つならそのドメインを、複数ならWorkspaceのアカウントだけを表示する"*"を付与する。
+// hdはユーザーが書き換えられるヒントでしかないので、id_tokenのhdの検証と組み合わせること
+func WithHostedDomain(domains []string) AuthOption {
+	return func(values url.Values) {
+		switch len(domains) {
+		case 0:
+			return
+		case 1:
+			values.Set("hd", domains[0])
+		default:
+			values.Set("hd", "*")
+		}
+	}
 }
 
 // AuthUrl は認可エンドポイントのURLを返す
-func (c oidcClient) AuthUrl(respType string, scopes []string, redirectUrl string, state string) string {
-	return fmt.Sprintf(
+func (c oidcClient) AuthUrl(
+	respType string,
+	scopes []string,
+	redirectUrl string,
+	state string,
+	opts ...AuthOption,
+) string {
+	authUrl := fmt.Sprintf(
 		"%s?client_id=%s&response_type=%s&scope=%s&redirect_uri=%s&state=%s",
 		c.authEndpoint,
 		c.ClientId,
@@ -77,56 +222,117 @@ func (c oidcClient) AuthUrl(respType string, scopes []string, redirectUrl string
 		redirectUrl,
 		state,
 	)
+
+	extra := url.Values{}
+	for _, opt := range opts {
+		opt(extra)
+	}
+	if len(extra) > 0 {
+		authUrl += "&" + extra.Encode()
+	}
+
+	return authUrl
 }
 
 // PostTokenEndpoint はトークンエンドポイントに認可コードを渡してトークンを得る
-func (c oidcClient) PostTokenEndpoint(code string, redirectUrl string, grantType string) (tokenResponse, error) {
+//
+// 認可リクエストでcode_challengeを送った場合はcodeVerifierに対応するcode_verifierを渡す。PKCEを使わない場合は空文字
+func (c oidcClient) PostTokenEndpoint(
+	code string,
+	redirectUrl string,
+	grantType string,
+	codeVerifier string,
+) (tokenResponse, error) {
+	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), httpTimeoutSec*time.Second)
+	defer cancel()
+
+	return c.exchangeCode(ctxWithTimeout, code, redirectUrl, grantType, codeVerifier)
+}
+
+// exchangeCode はトークンエンドポイントに認可コードを渡してトークンを得る。PostTokenEndpointとExchangeで共通
+func (c oidcClient) exchangeCode(
+	ctx context.Context,
+	code string,
+	redirectUrl string,
+	grantType string,
+	codeVerifier string,
+) (tokenResponse, error) {
 	values := url.Values{}
 	values.Add("code", code)
-	values.Add("client_id", c.ClientId)
-	values.Add("client_secret", string(c.clientSecret))
 	values.Add("redirect_uri", redirectUrl)
 	values.Add("grant_type", grantType)
+	if codeVerifier != "" {
+		if err := validateCodeVerifier(codeVerifier); err != nil {
+			return tokenResponse{}, err
+		}
+		values.Add("code_verifier", codeVerifier)
+	}
 
-	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), httpTimeoutSec*time.Second)
-	defer cancel()
-	reqWithCtx, err := http.NewRequestWithContext(
-		ctxWithTimeout,
-		http.MethodPost,
-		c.tokenEndpoint,
-		strings.NewReader(values.Encode()),
-	)
+	return c.postTokenRequest(ctx, values)
+}
+
+// Refresh はリフレッシュトークンを使って新しいアクセストークンを得る
+//
+// IdPによってはリフレッシュトークンも新しいものに置き換わるので、レスポンスのRefreshTokenが空でなければそちらを保存すること
+func (c oidcClient) Refresh(ctx context.Context, refreshToken string) (tokenResponse, error) {
+	values := url.Values{}
+	values.Add("grant_type", "refresh_token")
+	values.Add("refresh_token", refreshToken)
+
+	return c.postTokenRequest(ctx, values)
+}
+
+// postTokenRequest はトークンエンドポイントにvaluesをPOSTし、レスポンスを解釈する
+//
+// エラーレスポンスはTokenErrorとして返すので、errors.Asでエラーコードを取り出せる
+func (c oidcClient) postTokenRequest(ctx context.Context, values url.Values) (tokenResponse, error) {
+	reqWithCtx, err := c.newClientAuthRequest(ctx, c.tokenEndpoint, values)
 	if err != nil {
-		return tokenResponse{}, fmt.Errorf("failed to create request of POST token endpoint: %w", err)
+		return tokenResponse{}, err
 	}
-	reqWithCtx.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	httpClient := &http.Client{}
 	resp, err := httpClient.Do(reqWithCtx)
 	if err != nil {
 		return tokenResponse{}, fmt.Errorf("failed to POST token endpoint: %w", err)
 	}
-	defer func(body io.ReadCloser) {
-		err := body.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(resp.Body)
-	bRespBody, _ := ioutil.ReadAll(resp.Body)
+	defer closeBody(resp.Body)
 
-	tokenResp := &tokenResponse{}
-	if err := json.Unmarshal(bRespBody, tokenResp); err != nil {
-		return tokenResponse{}, fmt.Errorf("failed to unmarshal token response: %w", err)
+	bRespBody, err := readTokenResponseBody(resp)
+	if err != nil {
+		return tokenResponse{}, err
 	}
 
-	return *tokenResp, nil
+	return parseTokenResponse(resp.StatusCode, bRespBody)
+}
+
+// closeBody はレスポンスのボディを閉じる
+//
+// JWKsはバックグラウンドのgoroutineでも取得するので、panicでサーバーごと止めないようにログに出力するだけにする
+func closeBody(body io.ReadCloser) {
+	if err := body.Close(); err != nil {
+		l := logger.New(false)
+		l.Logger.Error().Err(err).Msg("failed to close response body")
+	}
 }
 
 // RandomState はCSRF攻撃の対策に使うためにランダムな文字列を返す。
 func RandomState() (string, error) {
+	const strLength = 32
+
+	return randomString(strLength)
+}
+
+// RandomNonce はid_tokenのリプレイ攻撃の対策に使うためにランダムな文字列を返す。
+func RandomNonce() (string, error) {
+	const strLength = 32
+
+	return randomString(strLength)
+}
+
+func randomString(strLength int) (string, error) {
 	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 	// 乱数を生成
-	const strLength = 10
 	b := make([]byte, strLength)
 	if _, err := rand.Read(b); err != nil {
 		return "", errors.New("unexpected error")
@@ -0,0 +1,210 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// token_endpoint_auth_methodとして定められたクライアント認証方式
+//
+// refs: https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+const (
+	ClientSecretPost  = "client_secret_post"
+	ClientSecretBasic = "client_secret_basic"
+	ClientSecretJwt   = "client_secret_jwt"
+	PrivateKeyJwt     = "private_key_jwt"
+)
+
+const (
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// clientAssertionLifetime はclient_assertionの有効期間。リクエストごとに作り直すので短くてよい
+	clientAssertionLifetime = 5 * time.Minute
+	jtiLength               = 32
+)
+
+var (
+	errUnsupportedAuthMethod = errors.New("unsupported token_endpoint_auth_method")
+	errUnsupportedSigningKey = errors.New("unsupported private key for private_key_jwt")
+)
+
+// clientAuthenticator はトークンエンドポイントなどへのリクエストにクライアント認証の情報を付与する
+//
+// audienceにはclient_assertionのaudとして使う、トークンエンドポイントのURLを渡す
+type clientAuthenticator interface {
+	authenticate(values url.Values, header http.Header, audience string) error
+}
+
+// clientSecretPostAuth はclient_idとclient_secretをフォームのボディで送る
+type clientSecretPostAuth struct {
+	clientId     string
+	clientSecret clientSecret
+}
+
+func (a clientSecretPostAuth) authenticate(values url.Values, _ http.Header, _ string) error {
+	values.Set("client_id", a.clientId)
+	values.Set("client_secret", string(a.clientSecret))
+
+	return nil
+}
+
+// clientSecretBasicAuth はclient_idとclient_secretをBasic認証のヘッダで送る
+type clientSecretBasicAuth struct {
+	clientId     string
+	clientSecret clientSecret
+}
+
+func (a clientSecretBasicAuth) authenticate(_ url.Values, header http.Header, _ string) error {
+	// RFC 6749 2.3.1ではBasic認証の前にform-urlencodeすることになっている
+	credentials := url.QueryEscape(a.clientId) + ":" + url.QueryEscape(string(a.clientSecret))
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+
+	return nil
+}
+
+// clientSecretJwtAuth はclient_secretでHS256署名したJWTをclient_assertionとして送る
+type clientSecretJwtAuth struct {
+	clientId     string
+	clientSecret clientSecret
+}
+
+func (a clientSecretJwtAuth) authenticate(values url.Values, _ http.Header, audience string) error {
+	return setClientAssertion(values, a.clientId, audience, jwt.SigningMethodHS256, "", []byte(a.clientSecret))
+}
+
+// privateKeyJwtAuth は秘密鍵で署名したJWTをclient_assertionとして送る。共有するclient_secretが存在しない
+type privateKeyJwtAuth struct {
+	clientId string
+	key      interface{}
+	kid      string
+	method   jwt.SigningMethod
+}
+
+func (a privateKeyJwtAuth) authenticate(values url.Values, _ http.Header, audience string) error {
+	return setClientAssertion(values, a.clientId, audience, a.method, a.kid, a.key)
+}
+
+// String は秘密鍵がログに出力されないようにマスクする
+func (a privateKeyJwtAuth) String() string {
+	return fmt.Sprintf("private_key_jwt(client_id=%s, kid=%s, key=%s)", a.clientId, a.kid, secretMaskingStr)
+}
+
+// GoString は秘密鍵がログに出力されないようにマスクする
+func (a privateKeyJwtAuth) GoString() string {
+	return a.String()
+}
+
+// setClientAssertion はiss, subがclient_id、audがトークンエンドポイントで、一意なjtiと短いexpを持つJWTを署名してセットする
+func setClientAssertion(
+	values url.Values,
+	clientId string,
+	audience string,
+	method jwt.SigningMethod,
+	kid string,
+	key interface{},
+) error {
+	jti, err := randomString(jtiLength)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(method, jwt.StandardClaims{
+		Issuer:    clientId,
+		Subject:   clientId,
+		Audience:  audience,
+		Id:        jti,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(clientAssertionLifetime).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	assertion, err := token.SignedString(key)
+	if err != nil {
+		return fmt.Errorf("failed to sign client_assertion: %w", err)
+	}
+
+	values.Set("client_id", clientId)
+	values.Set("client_assertion_type", clientAssertionType)
+	values.Set("client_assertion", assertion)
+
+	return nil
+}
+
+// SetTokenEndpointAuthMethod はclient_secretを使うクライアント認証方式を設定する
+//
+// private_key_jwtを使う場合はUsePrivateKeyJwtを呼ぶ
+func (c *oidcClient) SetTokenEndpointAuthMethod(method string) error {
+	switch method {
+	case ClientSecretPost:
+		c.clientAuth = clientSecretPostAuth{clientId: c.ClientId, clientSecret: c.clientSecret}
+	case ClientSecretBasic:
+		c.clientAuth = clientSecretBasicAuth{clientId: c.ClientId, clientSecret: c.clientSecret}
+	case ClientSecretJwt:
+		c.clientAuth = clientSecretJwtAuth{clientId: c.ClientId, clientSecret: c.clientSecret}
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedAuthMethod, method)
+	}
+
+	return nil
+}
+
+// UsePrivateKeyJwt はkeyで署名したJWTでクライアント認証するように設定する
+//
+// keyは*rsa.PrivateKey(RS256)か、P-256の*ecdsa.PrivateKey(ES256)。kidはIdPに登録した公開鍵のkid
+func (c *oidcClient) UsePrivateKeyJwt(key interface{}, kid string) error {
+	var method jwt.SigningMethod
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return fmt.Errorf("%w: curve %s", errUnsupportedSigningKey, k.Curve.Params().Name)
+		}
+		method = jwt.SigningMethodES256
+	default:
+		return fmt.Errorf("%w: %T", errUnsupportedSigningKey, key)
+	}
+
+	c.clientAuth = privateKeyJwtAuth{clientId: c.ClientId, key: key, kid: kid, method: method}
+
+	return nil
+}
+
+// authenticator は設定されたクライアント認証方式を返す。設定されていなければclient_secret_post
+func (c oidcClient) authenticator() clientAuthenticator {
+	if c.clientAuth == nil {
+		return clientSecretPostAuth{clientId: c.ClientId, clientSecret: c.clientSecret}
+	}
+
+	return c.clientAuth
+}
+
+// newClientAuthRequest はクライアント認証を付与した、valuesをフォームで送るPOSTリクエストを作る
+func (c oidcClient) newClientAuthRequest(ctx context.Context, endpoint string, values url.Values) (*http.Request, error) {
+	header := http.Header{}
+	if err := c.authenticator().authenticate(values, header, c.tokenEndpoint); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request of POST %s: %w", endpoint, err)
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	return req, nil
+}
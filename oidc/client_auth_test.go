@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTokenEndpoint = "https://idp.example.com/token"
+
+func authenticateForTest(t *testing.T, client *oidcClient) (url.Values, http.Header) {
+	t.Helper()
+
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	req, err := client.newClientAuthRequest(context.Background(), testTokenEndpoint, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+
+	return req.PostForm, req.Header
+}
+
+func TestClientAuth_ClientSecretPost(t *testing.T) {
+	client := newOidcClient(Generic, "client-id", "client-secret", "", testTokenEndpoint, "")
+
+	form, header := authenticateForTest(t, client)
+	assert.Equal(t, "client-id", form.Get("client_id"))
+	assert.Equal(t, "client-secret", form.Get("client_secret"))
+	assert.Equal(t, "", header.Get("Authorization"))
+}
+
+func TestClientAuth_ClientSecretBasic(t *testing.T) {
+	client := newOidcClient(Generic, "client:id", "secret/with+symbols", "", testTokenEndpoint, "")
+	assert.Nil(t, client.SetTokenEndpointAuthMethod(ClientSecretBasic))
+
+	form, header := authenticateForTest(t, client)
+	assert.Equal(t, "", form.Get("client_secret"))
+
+	// Basic認証の前にform-urlencodeされている
+	req := &http.Request{Header: header}
+	user, pass, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "client%3Aid", user)
+	assert.Equal(t, "secret%2Fwith%2Bsymbols", pass)
+}
+
+func parseClientAssertion(t *testing.T, form url.Values, key interface{}) *jwt.StandardClaims {
+	t.Helper()
+
+	assert.Equal(t, clientAssertionType, form.Get("client_assertion_type"))
+	assert.Equal(t, "", form.Get("client_secret"))
+
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(form.Get("client_assertion"), claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, token.Valid)
+	assert.Equal(t, "client-id", claims.Issuer)
+	assert.Equal(t, "client-id", claims.Subject)
+	assert.Equal(t, testTokenEndpoint, claims.Audience)
+	assert.Len(t, claims.Id, jtiLength)
+	assert.InDelta(t, time.Now().Add(clientAssertionLifetime).Unix(), claims.ExpiresAt, 5)
+
+	return claims
+}
+
+func TestClientAuth_ClientSecretJwt(t *testing.T) {
+	client := newOidcClient(Generic, "client-id", "client-secret", "", testTokenEndpoint, "")
+	assert.Nil(t, client.SetTokenEndpointAuthMethod(ClientSecretJwt))
+
+	form, _ := authenticateForTest(t, client)
+	first := parseClientAssertion(t, form, []byte("client-secret"))
+
+	// jtiはリクエストごとに一意
+	form, _ = authenticateForTest(t, client)
+	second := parseClientAssertion(t, form, []byte("client-secret"))
+	assert.NotEqual(t, first.Id, second.Id)
+}
+
+func TestClientAuth_PrivateKeyJwt(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	patterns := []struct {
+		desc   string
+		key    interface{}
+		pubKey interface{}
+		alg    string
+	}{
+		{"RSA", rsaKey, &rsaKey.PublicKey, "RS256"},
+		{"ECDSA", ecKey, &ecKey.PublicKey, "ES256"},
+	}
+
+	for _, pattern := range patterns {
+		client := newOidcClient(Generic, "client-id", "", "", testTokenEndpoint, "")
+		assert.Nil(t, client.UsePrivateKeyJwt(pattern.key, "key-1"), pattern.desc)
+
+		form, _ := authenticateForTest(t, client)
+		parseClientAssertion(t, form, pattern.pubKey)
+
+		token, _, err := new(jwt.Parser).ParseUnverified(form.Get("client_assertion"), &jwt.StandardClaims{})
+		assert.Nil(t, err)
+		assert.Equal(t, pattern.alg, token.Header["alg"], pattern.desc)
+		assert.Equal(t, "key-1", token.Header["kid"], pattern.desc)
+
+		// 秘密鍵はログに出力されない
+		assert.NotContains(t, fmt.Sprintf("%v %#v", client.clientAuth, client.clientAuth), "PrivateKey")
+	}
+}
+
+func TestClientAuth_Unsupported(t *testing.T) {
+	client := newOidcClient(Generic, "client-id", "", "", testTokenEndpoint, "")
+
+	assert.ErrorIs(t, client.SetTokenEndpointAuthMethod(PrivateKeyJwt), errUnsupportedAuthMethod)
+	assert.ErrorIs(t, client.SetTokenEndpointAuthMethod("none"), errUnsupportedAuthMethod)
+
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.ErrorIs(t, client.UsePrivateKeyJwt(p384Key, ""), errUnsupportedSigningKey)
+	assert.ErrorIs(t, client.UsePrivateKeyJwt([]byte("secret"), ""), errUnsupportedSigningKey)
+}
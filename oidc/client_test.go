@@ -1,9 +1,14 @@
 package oidc
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -81,7 +86,7 @@ func TestOidcClient_PostTokenEndpoint(t *testing.T) {
 		),
 	)
 
-	actual, _ := client.PostTokenEndpoint("", "", "")
+	actual, _ := client.PostTokenEndpoint("", "", "", "")
 	expected := tokenResponse{
 		AccessToken: "DummyAccessToken",
 		ExpiresIn:   3566,
@@ -93,10 +98,147 @@ func TestOidcClient_PostTokenEndpoint(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+func TestOidcClient_AuthUrl_WithCodeChallenge(t *testing.T) {
+	client := NewGoogleOidcClient()
+	challenge := CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+
+	actual := client.AuthUrl(
+		"code",
+		[]string{"openid"},
+		"http://localhost:8000/auth/google/sign_up/callback",
+		"12345678",
+		WithCodeChallenge(challenge),
+	)
+
+	assert.Equal(
+		t,
+		"https://accounts.google.com/o/oauth2/v2/auth?client_id=&response_type=code&scope=openid"+
+			"&redirect_uri=http://localhost:8000/auth/google/sign_up/callback&state=12345678"+
+			"&code_challenge=E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM&code_challenge_method=S256",
+		actual,
+	)
+}
+
+func TestOidcClient_PostTokenEndpoint_CodeVerifier(t *testing.T) {
+	client := NewGoogleOidcClient()
+	verifier, _ := RandomCodeVerifier()
+	challenge := CodeChallengeS256(verifier)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", client.tokenEndpoint,
+		func(req *http.Request) (*http.Response, error) {
+			if err := req.ParseForm(); err != nil {
+				return nil, err
+			}
+			// 認可サーバーと同じようにcode_challengeとcode_verifierの対応を確認する
+			if !VerifyCodeChallenge(req.PostForm.Get("code_verifier"), challenge) {
+				return httpmock.NewStringResponse(400, `{"error": "invalid_grant"}`), nil
+			}
+
+			return httpmock.NewStringResponse(200, `{"access_token": "DummyAccessToken"}`), nil
+		},
+	)
+
+	actual, err := client.PostTokenEndpoint("", "", "authorization_code", verifier)
+	assert.Nil(t, err)
+	assert.Equal(t, "DummyAccessToken", actual.AccessToken)
+
+	otherVerifier, _ := RandomCodeVerifier()
+	_, err = client.PostTokenEndpoint("", "", "authorization_code", otherVerifier)
+	var tokenErr *TokenError
+	assert.True(t, errors.As(err, &tokenErr))
+	assert.Equal(t, TokenErrorInvalidGrant, tokenErr.Code)
+
+	_, err = client.PostTokenEndpoint("", "", "authorization_code", "too-short")
+	assert.ErrorIs(t, err, errInvalidCodeVerifier)
+}
+
+func TestOidcClient_Refresh(t *testing.T) {
+	client := NewGoogleOidcClient()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", client.tokenEndpoint,
+		func(req *http.Request) (*http.Response, error) {
+			if err := req.ParseForm(); err != nil {
+				return nil, err
+			}
+			if req.PostForm.Get("grant_type") != "refresh_token" || req.PostForm.Get("refresh_token") != "DummyRefreshToken" {
+				return httpmock.NewStringResponse(400, `{"error": "invalid_grant"}`), nil
+			}
+
+			return httpmock.NewStringResponse(200, `{"access_token": "NewAccessToken", "expires_in": 3599}`), nil
+		},
+	)
+
+	actual, err := client.Refresh(context.Background(), "DummyRefreshToken")
+	assert.Nil(t, err)
+	assert.Equal(t, tokenResponse{AccessToken: "NewAccessToken", ExpiresIn: 3599}, actual)
+
+	_, err = client.Refresh(context.Background(), "RevokedRefreshToken")
+	var tokenErr *TokenError
+	assert.True(t, errors.As(err, &tokenErr))
+}
+
+func TestOidcClient_AuthUrl_WithOfflineAccess(t *testing.T) {
+	actual := NewGoogleOidcClient().AuthUrl("code", []string{"openid"}, "", "", WithOfflineAccess())
+
+	assert.True(t, strings.HasSuffix(actual, "&access_type=offline&prompt=consent"))
+}
+
+func TestOidcClient_AuthUrl_WithHostedDomain(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		domains  []string
+		expected string
+	}{
+		{"ドメインなし", nil, ""},
+		{"1つのドメイン", []string{"example.com"}, "example.com"},
+		{"複数のドメイン", []string{"example.com", "example.co.jp"}, "*"},
+	}
+
+	for _, pattern := range patterns {
+		actual := NewGoogleOidcClient().AuthUrl("code", []string{"openid"}, "", "", WithHostedDomain(pattern.domains))
+
+		authUrl, err := url.Parse(actual)
+		assert.Nil(t, err, pattern.desc)
+		assert.Equal(t, pattern.expected, authUrl.Query().Get("hd"), pattern.desc)
+	}
+}
+
+func TestOidcClient_SetAllowedHostedDomains(t *testing.T) {
+	client := NewGoogleOidcClient()
+	client.SetAllowedHostedDomains([]string{" example.com", "", "example.co.jp "})
+
+	assert.Equal(t, []string{"example.com", "example.co.jp"}, client.ValidationParams().AllowedHostedDomains)
+}
+
 func TestRandomState(t *testing.T) {
 	state, err := RandomState()
 
-	const expectedLength = 10
+	const expectedLength = 32
 	assert.Nil(t, err)
 	assert.Equal(t, expectedLength, len(state))
 }
+
+func TestRandomNonce(t *testing.T) {
+	nonce, err := RandomNonce()
+
+	const expectedLength = 32
+	assert.Nil(t, err)
+	assert.Equal(t, expectedLength, len(nonce))
+}
+
+type failingCloser struct {
+	*strings.Reader
+}
+
+func (failingCloser) Close() error {
+	return errors.New("close failed")
+}
+
+func TestCloseBody(t *testing.T) {
+	// バックグラウンドのJWKsの取得からも呼ばれるので、閉じられなくてもpanicしない
+	assert.NotPanics(t, func() { closeBody(failingCloser{strings.NewReader("")}) })
+}
@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+var (
+	errDiscoveryIssuerMismatch = errors.New("discovery document issuer mismatch")
+	errDiscoveryMissingField   = errors.New("discovery document missing required field")
+)
+
+// discoveryDocument は.well-known/openid-configurationのレスポンスをunmarshalするための構造体
+//
+// refs: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type discoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
+	JwksUri                          string   `json:"jwks_uri"`
+	RevocationEndpoint               string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethods         []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// NewOidcClientFromDiscovery はissuerの.well-known/openid-configurationを取得し、その内容からクライアントを返す
+//
+// ドキュメント中のissuerは引数のissuerと完全に一致していなければならない
+func NewOidcClientFromDiscovery(issuer string, clientId string, secret string) (*oidcClient, error) {
+	doc, err := fetchDiscoveryDocument(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := doc.validate(issuer); err != nil {
+		return nil, err
+	}
+
+	client := newOidcClient(
+		idProviderFromIssuer(doc.Issuer),
+		clientId,
+		clientSecret(secret),
+		doc.AuthorizationEndpoint,
+		doc.TokenEndpoint,
+		doc.JwksUri,
+	)
+	client.Issuer = doc.Issuer
+	client.userinfoEndpoint = doc.UserinfoEndpoint
+	client.revocationEndpoint = doc.RevocationEndpoint
+	client.introspectionEndpoint = doc.IntrospectionEndpoint
+	client.allowedAlgs = doc.IdTokenSigningAlgValuesSupported
+	if err := client.SetTokenEndpointAuthMethod(doc.defaultAuthMethod()); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// defaultAuthMethod はclient_secretを使う認証方式のうち、IdPが対応しているものを返す
+//
+// token_endpoint_auth_methods_supportedが省略された場合のデフォルトはclient_secret_basic
+func (doc discoveryDocument) defaultAuthMethod() string {
+	if len(doc.TokenEndpointAuthMethods) == 0 {
+		return ClientSecretBasic
+	}
+
+	for _, method := range doc.TokenEndpointAuthMethods {
+		if method == ClientSecretBasic || method == ClientSecretPost {
+			return method
+		}
+	}
+
+	return ClientSecretBasic
+}
+
+func fetchDiscoveryDocument(issuer string) (discoveryDocument, error) {
+	discoveryUrl := strings.TrimSuffix(issuer, "/") + discoveryPath
+
+	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), httpTimeoutSec*time.Second)
+	defer cancel()
+	reqWithCtx, err := http.NewRequestWithContext(ctxWithTimeout, http.MethodGet, discoveryUrl, nil)
+	if err != nil {
+		return discoveryDocument{}, fmt.Errorf("failed to create request of GET discovery endpoint: %w", err)
+	}
+
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(reqWithCtx)
+	if err != nil {
+		return discoveryDocument{}, fmt.Errorf("failed to GET discovery endpoint: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return discoveryDocument{}, fmt.Errorf("unexpected status of discovery endpoint: %d", resp.StatusCode)
+	}
+	bRespBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return discoveryDocument{}, fmt.Errorf("failed to read discovery document: %w", err)
+	}
+
+	doc := &discoveryDocument{}
+	if err := json.Unmarshal(bRespBody, doc); err != nil {
+		return discoveryDocument{}, fmt.Errorf("failed to unmarshal discovery document: %w", err)
+	}
+
+	return *doc, nil
+}
+
+// validate はDiscoveryで必須とされている項目と、issuerの一致を確認する
+func (doc discoveryDocument) validate(issuer string) error {
+	if doc.Issuer != issuer {
+		return fmt.Errorf("%w: expected %s, got %s", errDiscoveryIssuerMismatch, issuer, doc.Issuer)
+	}
+
+	required := []struct {
+		field string
+		ok    bool
+	}{
+		{"authorization_endpoint", doc.AuthorizationEndpoint != ""},
+		{"token_endpoint", doc.TokenEndpoint != ""},
+		{"jwks_uri", doc.JwksUri != ""},
+		{"response_types_supported", len(doc.ResponseTypesSupported) > 0},
+		{"subject_types_supported", len(doc.SubjectTypesSupported) > 0},
+		{"id_token_signing_alg_values_supported", len(doc.IdTokenSigningAlgValuesSupported) > 0},
+	}
+	for _, r := range required {
+		if !r.ok {
+			return fmt.Errorf("%w: %s", errDiscoveryMissingField, r.field)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package oidc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDiscoveryServer(t *testing.T, docFn func(issuer string) string) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != discoveryPath {
+			http.NotFound(w, r)
+
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, docFn(server.URL))
+	}))
+
+	return server
+}
+
+func TestNewOidcClientFromDiscovery(t *testing.T) {
+	patterns := []struct {
+		desc          string
+		isExpectValid bool
+		doc           func(issuer string) string
+	}{
+		{
+			"valid",
+			true,
+			func(issuer string) string {
+				return fmt.Sprintf(`{
+  "issuer": "%[1]s",
+  "authorization_endpoint": "%[1]s/auth",
+  "token_endpoint": "%[1]s/token",
+  "userinfo_endpoint": "%[1]s/userinfo",
+  "revocation_endpoint": "%[1]s/revoke",
+  "introspection_endpoint": "%[1]s/introspect",
+  "jwks_uri": "%[1]s/certs",
+  "scopes_supported": ["openid", "email", "profile"],
+  "response_types_supported": ["code", "id_token"],
+  "subject_types_supported": ["public"],
+  "id_token_signing_alg_values_supported": ["RS256"]
+}`, issuer)
+			},
+		},
+		{
+			"issuerが一致しない",
+			false,
+			func(issuer string) string {
+				return fmt.Sprintf(`{
+  "issuer": "%[1]s/",
+  "authorization_endpoint": "%[1]s/auth",
+  "token_endpoint": "%[1]s/token",
+  "jwks_uri": "%[1]s/certs",
+  "response_types_supported": ["code"],
+  "subject_types_supported": ["public"],
+  "id_token_signing_alg_values_supported": ["RS256"]
+}`, issuer)
+			},
+		},
+		{
+			"jwks_uriがない",
+			false,
+			func(issuer string) string {
+				return fmt.Sprintf(`{
+  "issuer": "%[1]s",
+  "authorization_endpoint": "%[1]s/auth",
+  "token_endpoint": "%[1]s/token",
+  "response_types_supported": ["code"],
+  "subject_types_supported": ["public"],
+  "id_token_signing_alg_values_supported": ["RS256"]
+}`, issuer)
+			},
+		},
+		{
+			"JSONではない",
+			false,
+			func(issuer string) string {
+				return "<html></html>"
+			},
+		},
+	}
+
+	for _, pattern := range patterns {
+		server := newDiscoveryServer(t, pattern.doc)
+
+		client, err := NewOidcClientFromDiscovery(server.URL, "client-id", "client-secret")
+		if pattern.isExpectValid {
+			assert.Nil(t, err, pattern.desc)
+			assert.Equal(t, Generic, client.IdProvider)
+			assert.Equal(t, server.URL, client.Issuer)
+			assert.Equal(t, server.URL+"/auth", client.authEndpoint)
+			assert.Equal(t, server.URL+"/token", client.tokenEndpoint)
+			assert.Equal(t, server.URL+"/certs", client.JwksEndpoint)
+			assert.Equal(t, server.URL+"/userinfo", client.userinfoEndpoint)
+			assert.Equal(t, server.URL+"/revoke", client.revocationEndpoint)
+			assert.Equal(t, server.URL+"/introspect", client.introspectionEndpoint)
+			// id_tokenの署名はid_token_signing_alg_values_supportedのアルゴリズムだけを受け入れる
+			assert.Equal(t, []string{"RS256"}, client.allowedAlgs)
+			// token_endpoint_auth_methods_supportedが省略された場合はclient_secret_basic
+			assert.IsType(t, clientSecretBasicAuth{}, client.authenticator())
+		} else {
+			assert.Error(t, err, pattern.desc)
+		}
+
+		server.Close()
+	}
+}
@@ -0,0 +1,112 @@
+package oidc
+
+import (
+	"context"
+	"time"
+)
+
+// Identity はログインしたユーザーについてIdPから得られた情報
+type Identity struct {
+	IdProvider IdProvider
+	// Subject はIdPの中でユーザーを一意に識別する値。基本はsubだが、Microsoftではtidとoidの組
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// Claims はid_token(とUserInfo)のクレーム
+	Claims StandardClaims
+	// Token はトークンエンドポイントから得たアクセストークンとリフレッシュトークン
+	Token Token
+	// Microsoft はMicrosoftでログインした場合のテナントとユーザーの情報。他のIdPではゼロ値
+	Microsoft MicrosoftIdentity
+	// Apple はAppleでログインした場合のリレーサービスと実在性の情報。他のIdPではゼロ値
+	Apple AppleIdentity
+}
+
+// HasAmr はユーザーがmethodの方法で認証したかどうか。id_tokenのamrクレームで判断する
+func (identity Identity) HasAmr(method string) bool {
+	for _, v := range identity.Claims.Amr {
+		if v == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// userKeyer はsub以外の値でユーザーを識別するIdPのpayloadが実装する
+type userKeyer interface {
+	GetUserKey() string
+}
+
+// identityExtender は標準のクレーム以外の情報をIdentityに追加するIdPのpayloadが実装する
+type identityExtender interface {
+	extendIdentity(identity *Identity)
+}
+
+// Exchange は認可コードをトークンに交換し、id_tokenを検証してユーザーの情報を返す
+//
+// codeVerifierとnonceには認可リクエストの前に保存しておいた値を渡す。
+// IdPが応答しなくてもコールバックが止まったままにならないように、トークンとUserInfoの取得はhttpTimeoutSecで打ち切る
+func (c oidcClient) Exchange(
+	ctx context.Context,
+	code string,
+	redirectUrl string,
+	codeVerifier string,
+	nonce string,
+) (Identity, error) {
+	ctx, cancel := context.WithTimeout(ctx, httpTimeoutSec*time.Second)
+	defer cancel()
+
+	// 認可コードを取り出しトークンエンドポイントに投げることでid_tokenを取得できる
+	tokenResp, err := c.exchangeCode(ctx, code, redirectUrl, "authorization_code", codeVerifier)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	// JWKsエンドポイントから公開鍵を取得しid_token(JWT)の署名を検証。改竄されていないことを確認する
+	idToken, err := NewIdToken(tokenResp.IdToken, c.IdProvider)
+	if err != nil {
+		return Identity{}, validationError(err)
+	}
+	params := c.ValidationParams()
+	params.Nonce = nonce
+	if err := idToken.Validate(params); err != nil {
+		return Identity{}, validationError(err)
+	}
+
+	// id_tokenにメールアドレスが入っていない場合はUserInfoエンドポイントから補う
+	claims := idToken.Payload.GetClaims()
+	if claims.Email == "" && c.userinfoEndpoint != "" {
+		userInfo, err := c.UserInfo(ctx, tokenResp.AccessToken)
+		if err != nil {
+			return Identity{}, err
+		}
+		if claims, err = claims.MergeUserInfo(userInfo); err != nil {
+			return Identity{}, validationError(err)
+		}
+	}
+
+	subject := claims.Sub
+	if keyer, ok := idToken.Payload.(userKeyer); ok {
+		subject = keyer.GetUserKey()
+	}
+
+	identity := Identity{
+		IdProvider:    c.IdProvider,
+		Subject:       subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Claims:        claims,
+		Token:         tokenResp.Token(),
+	}
+	if extender, ok := idToken.Payload.(identityExtender); ok {
+		extender.extendIdentity(&identity)
+	}
+	if err := c.claimMapping.apply(&identity); err != nil {
+		return Identity{}, validationError(err)
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,154 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+var (
+	errInvalidProviderConfig = errors.New("invalid provider config")
+	errMappedClaimMissing    = errors.New("mapped claim missing")
+)
+
+// providerNamePattern はURLのパスに使うプロバイダ名として許可する文字列
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// envReferencePattern はclient_idとclient_secretで環境変数を参照する${NAME}の形式
+var envReferencePattern = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// defaultGenericScopes は設定でscopesを省略した場合に要求するスコープ
+var defaultGenericScopes = []string{"openid", "email", "profile"}
+
+// ClaimMapping はどのクレームをユーザーの識別子、メールアドレス、表示名として使うか
+//
+// 空の場合はそれぞれsub, email, nameを使う
+type ClaimMapping struct {
+	Subject string `json:"subject"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+}
+
+// GenericProviderConfig はKeycloak, Auth0, OktaなどのOIDCに準拠したIdPを追加するための設定
+type GenericProviderConfig struct {
+	// Name は/auth/{name}/loginのようにURLのパスに使うプロバイダ名
+	Name string `json:"name"`
+	// DisplayName はログイン画面に表示する名前
+	DisplayName  string       `json:"display_name"`
+	Issuer       string       `json:"issuer"`
+	ClientId     string       `json:"client_id"`
+	ClientSecret clientSecret `json:"client_secret"`
+	Scopes       []string     `json:"scopes"`
+	Claims       ClaimMapping `json:"claims"`
+}
+
+// LoadGenericProviderConfigs はJSONの設定ファイルからIdPの設定を読み込む
+//
+// client_idとclient_secretを設定ファイルに書かなくて済むように、値全体が${KEYCLOAK_CLIENT_SECRET}の形式の場合は環境変数を展開する。
+// それ以外の項目や、$を含むだけの値はそのまま使う
+func LoadGenericProviderConfigs(path string) ([]GenericProviderConfig, error) {
+	bConfig, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider config: %w", err)
+	}
+
+	var configs []GenericProviderConfig
+	if err := json.Unmarshal(bConfig, &configs); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal: %s", errInvalidProviderConfig, err)
+	}
+
+	names := map[string]bool{}
+	for i := range configs {
+		configs[i].ClientId = expandEnvReference(configs[i].ClientId)
+		configs[i].ClientSecret = clientSecret(expandEnvReference(string(configs[i].ClientSecret)))
+		if err := configs[i].validate(); err != nil {
+			return nil, err
+		}
+		if names[configs[i].Name] {
+			return nil, fmt.Errorf("%w: duplicate name %s", errInvalidProviderConfig, configs[i].Name)
+		}
+		names[configs[i].Name] = true
+
+		if len(configs[i].Scopes) == 0 {
+			configs[i].Scopes = defaultGenericScopes
+		}
+		if configs[i].DisplayName == "" {
+			configs[i].DisplayName = configs[i].Name
+		}
+	}
+
+	return configs, nil
+}
+
+// expandEnvReference は値全体が${NAME}の形式の場合に環境変数NAMEの値を返す。それ以外はそのまま返す
+func expandEnvReference(v string) string {
+	matches := envReferencePattern.FindStringSubmatch(v)
+	if matches == nil {
+		return v
+	}
+
+	return os.Getenv(matches[1])
+}
+
+func (config GenericProviderConfig) validate() error {
+	if !providerNamePattern.MatchString(config.Name) {
+		return fmt.Errorf("%w: invalid name %q", errInvalidProviderConfig, config.Name)
+	}
+	if config.Issuer == "" || config.ClientId == "" {
+		return fmt.Errorf("%w: %s: issuer and client_id are required", errInvalidProviderConfig, config.Name)
+	}
+
+	return nil
+}
+
+// NewGenericOidcClient は設定のissuerのDiscoveryからクライアントを返す
+//
+// id_tokenは組み込みのIdPと同じくidToken.Validateで検証し、その後でクレームのマッピングを適用する
+func NewGenericOidcClient(config GenericProviderConfig) (*oidcClient, error) {
+	client, err := NewOidcClientFromDiscovery(config.Issuer, config.ClientId, string(config.ClientSecret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure %s: %w", config.Name, err)
+	}
+	client.claimMapping = config.Claims
+
+	return client, nil
+}
+
+// apply はマッピングに従ってIdentityのSubject, Email, Nameをクレームの値で置き換える
+func (mapping ClaimMapping) apply(identity *Identity) error {
+	if mapping.Subject != "" {
+		v, ok := claimString(identity.Claims.Raw, mapping.Subject)
+		if !ok || v == "" {
+			return fmt.Errorf("%w: %s", errMappedClaimMissing, mapping.Subject)
+		}
+		identity.Subject = v
+	}
+	if mapping.Email != "" {
+		v, _ := claimString(identity.Claims.Raw, mapping.Email)
+		identity.Email = v
+		// 標準のemail以外のクレームは確認済みかどうかわからない
+		identity.EmailVerified = mapping.Email == "email" && identity.Claims.EmailVerified
+	}
+	if mapping.Name != "" {
+		v, _ := claimString(identity.Claims.Raw, mapping.Name)
+		identity.Name = v
+	}
+
+	return nil
+}
+
+// claimString は文字列か数値のクレームを文字列として取り出す
+func claimString(raw map[string]interface{}, name string) (string, bool) {
+	switch v := raw[name].(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,195 @@
+package oidc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeProviderConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "providers.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadGenericProviderConfigs(t *testing.T) {
+	_ = os.Setenv("TEST_KEYCLOAK_CLIENT_ID", "keycloak-id")
+	_ = os.Setenv("TEST_KEYCLOAK_CLIENT_SECRET", "keycloak-secret")
+	defer func() {
+		_ = os.Unsetenv("TEST_KEYCLOAK_CLIENT_ID")
+		_ = os.Unsetenv("TEST_KEYCLOAK_CLIENT_SECRET")
+	}()
+
+	patterns := []struct {
+		desc          string
+		isExpectValid bool
+		content       string
+	}{
+		{
+			"valid",
+			true,
+			`[{"name": "keycloak", "issuer": "https://kc.example.com/realms/a", "client_id": "${TEST_KEYCLOAK_CLIENT_ID}",
+  "client_secret": "${TEST_KEYCLOAK_CLIENT_SECRET}", "claims": {"name": "preferred_username"}}]`,
+		},
+		{"名前に使えない文字", false, `[{"name": "Key Cloak", "issuer": "https://kc.example.com", "client_id": "id"}]`},
+		{
+			"名前が重複",
+			false,
+			`[{"name": "okta", "issuer": "https://a.example.com", "client_id": "id"},
+  {"name": "okta", "issuer": "https://b.example.com", "client_id": "id"}]`,
+		},
+		{"issuerがない", false, `[{"name": "okta", "client_id": "id"}]`},
+		{
+			"client_idの環境変数が設定されていない",
+			false,
+			`[{"name": "okta", "issuer": "https://a.example.com", "client_id": "${TEST_OKTA_CLIENT_ID_UNSET}"}]`,
+		},
+		{"JSONではない", false, `name: okta`},
+	}
+
+	for _, pattern := range patterns {
+		path := writeProviderConfig(t, pattern.content)
+
+		configs, err := LoadGenericProviderConfigs(path)
+		if pattern.isExpectValid {
+			assert.Nil(t, err, pattern.desc)
+			assert.Len(t, configs, 1, pattern.desc)
+			assert.Equal(t, "keycloak-id", configs[0].ClientId, pattern.desc)
+			assert.Equal(t, clientSecret("keycloak-secret"), configs[0].ClientSecret, pattern.desc)
+			assert.Equal(t, defaultGenericScopes, configs[0].Scopes, pattern.desc)
+			assert.Equal(t, "keycloak", configs[0].DisplayName, pattern.desc)
+			assert.Equal(t, "preferred_username", configs[0].Claims.Name, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, errInvalidProviderConfig, pattern.desc)
+		}
+
+		_ = os.RemoveAll(filepath.Dir(path))
+	}
+}
+
+func TestExpandEnvReference(t *testing.T) {
+	_ = os.Setenv("TEST_CLIENT_SECRET", "from-env")
+	defer func() { _ = os.Unsetenv("TEST_CLIENT_SECRET") }()
+
+	patterns := []struct {
+		desc     string
+		value    string
+		expected string
+	}{
+		{"${NAME}の形式は展開する", "${TEST_CLIENT_SECRET}", "from-env"},
+		{"設定されていない環境変数は空文字", "${TEST_CLIENT_SECRET_UNSET}", ""},
+		{"$を含むだけの値はそのまま", "abc$TEST_CLIENT_SECRET", "abc$TEST_CLIENT_SECRET"},
+		{"値の一部の${NAME}は展開しない", "abc${TEST_CLIENT_SECRET}", "abc${TEST_CLIENT_SECRET}"},
+	}
+
+	for _, pattern := range patterns {
+		assert.Equal(t, pattern.expected, expandEnvReference(pattern.value), pattern.desc)
+	}
+}
+
+func TestClaimMapping_Apply(t *testing.T) {
+	claims := StandardClaims{
+		Sub:           "f:1234:jane",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Raw: map[string]interface{}{
+			"sub":                       "f:1234:jane",
+			"email":                     "jane@example.com",
+			"preferred_username":        "jane",
+			"employee_id":               float64(1234),
+			"https://example.com/email": "jane@corp.example.com",
+		},
+	}
+
+	patterns := []struct {
+		desc                  string
+		expected              error
+		mapping               ClaimMapping
+		expectedSubject       string
+		expectedEmail         string
+		expectedEmailVerified bool
+		expectedName          string
+	}{
+		{"マッピングなし", nil, ClaimMapping{}, "f:1234:jane", "jane@example.com", true, "Jane"},
+		{
+			"数値のクレームを識別子に使う",
+			nil,
+			ClaimMapping{Subject: "employee_id", Name: "preferred_username"},
+			"1234",
+			"jane@example.com",
+			true,
+			"jane",
+		},
+		{
+			"標準以外のメールアドレスは未確認として扱う",
+			nil,
+			ClaimMapping{Email: "https://example.com/email"},
+			"f:1234:jane",
+			"jane@corp.example.com",
+			false,
+			"Jane",
+		},
+		{"識別子のクレームがない", errMappedClaimMissing, ClaimMapping{Subject: "oid"}, "", "", false, ""},
+	}
+
+	for _, pattern := range patterns {
+		identity := Identity{
+			Subject:       claims.Sub,
+			Email:         claims.Email,
+			EmailVerified: claims.EmailVerified,
+			Name:          "Jane",
+			Claims:        claims,
+		}
+
+		err := pattern.mapping.apply(&identity)
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+			assert.Equal(t, pattern.expectedSubject, identity.Subject, pattern.desc)
+			assert.Equal(t, pattern.expectedEmail, identity.Email, pattern.desc)
+			assert.Equal(t, pattern.expectedEmailVerified, identity.EmailVerified, pattern.desc)
+			assert.Equal(t, pattern.expectedName, identity.Name, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+}
+
+func TestNewGenericOidcClient(t *testing.T) {
+	server := newDiscoveryServer(t, func(issuer string) string {
+		return `{
+  "issuer": "` + issuer + `",
+  "authorization_endpoint": "` + issuer + `/auth",
+  "token_endpoint": "` + issuer + `/token",
+  "jwks_uri": "` + issuer + `/certs",
+  "response_types_supported": ["code"],
+  "subject_types_supported": ["public"],
+  "id_token_signing_alg_values_supported": ["RS256"]
+}`
+	})
+	defer server.Close()
+
+	client, err := NewGenericOidcClient(GenericProviderConfig{
+		Name:     "keycloak",
+		Issuer:   server.URL,
+		ClientId: "client-id",
+		Claims:   ClaimMapping{Name: "preferred_username"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, Generic, client.IdProvider)
+	assert.Equal(t, "preferred_username", client.claimMapping.Name)
+
+	_, err = NewGenericOidcClient(GenericProviderConfig{Name: "broken", Issuer: server.URL + "/other"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	githubApiBase = "https://api.github.com"
+	// refs: https://docs.github.com/en/rest/about-the-rest-api/api-versions
+	githubAcceptHeader = "application/vnd.github+json"
+)
+
+var (
+	errGithubIdMissing         = errors.New("github user id missing")
+	errGithubNoVerifiedEmail   = errors.New("github user has no verified primary email")
+	errGithubEmailsUnavailable = errors.New("failed to get github emails")
+)
+
+// GithubEmailError はGitHubのユーザーに確認済みのプライマリのメールアドレスがないことを表すエラー
+//
+// ユーザーがGitHubでメールアドレスを確認すればログインできる
+type GithubEmailError struct {
+	Login string
+}
+
+func (e *GithubEmailError) Error() string {
+	return fmt.Sprintf("%s: %s", errGithubNoVerifiedEmail, e.Login)
+}
+
+func (e *GithubEmailError) Unwrap() error {
+	return errGithubNoVerifiedEmail
+}
+
+// NewGithubClient はGitHubのOAuth Appのクライアントを返す
+//
+// GitHubはid_tokenを発行しないので、/userと/user/emailsからユーザーの情報を取得する。
+// スコープにはread:userとuser:emailを要求すること
+func NewGithubClient() *oauth2Client {
+	return newGithubClient(
+		os.Getenv("GITHUB_CLIENT_ID"),
+		clientSecret(os.Getenv("GITHUB_CLIENT_SECRET")),
+		githubApiBase,
+	)
+}
+
+func newGithubClient(clientId string, secret clientSecret, apiBase string) *oauth2Client {
+	return &oauth2Client{
+		oauth: newOidcClient(
+			GitHub,
+			clientId,
+			secret,
+			"https://github.com/login/oauth/authorize",
+			"https://github.com/login/oauth/access_token",
+			"",
+		),
+		fetchProfile: func(ctx context.Context, accessToken string) (Identity, error) {
+			return fetchGithubProfile(ctx, apiBase, accessToken)
+		},
+	}
+}
+
+// githubUser は/userのレスポンスをunmarshalするための構造体
+//
+// refs: https://docs.github.com/en/rest/users/users#get-the-authenticated-user
+type githubUser struct {
+	// Id はGitHubのユーザーの数値のID。loginは変更できるので、こちらをユーザー識別子とする
+	Id        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarUrl string `json:"avatar_url"`
+	HtmlUrl   string `json:"html_url"`
+}
+
+// githubEmail は/user/emailsのレスポンスの要素
+//
+// refs: https://docs.github.com/en/rest/users/emails#list-email-addresses-for-the-authenticated-user
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// fetchGithubProfile は/userと/user/emailsからユーザーの情報を取得する
+//
+// /userのemailは公開設定のものしか返さず確認済みかもわからないので、/user/emailsから確認済みのプライマリを使う
+func fetchGithubProfile(ctx context.Context, apiBase string, accessToken string) (Identity, error) {
+	bUser, err := getWithToken(ctx, apiBase+"/user", accessToken, githubAcceptHeader)
+	if err != nil {
+		return Identity{}, err
+	}
+	user := githubUser{}
+	if err := json.Unmarshal(bUser, &user); err != nil {
+		return Identity{}, fmt.Errorf("failed to unmarshal github user: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(bUser, &raw); err != nil {
+		return Identity{}, fmt.Errorf("failed to unmarshal github user: %w", err)
+	}
+	if user.Id == 0 {
+		return Identity{}, errGithubIdMissing
+	}
+
+	// user:emailスコープが許可されていない場合は404になる
+	bEmails, err := getWithToken(ctx, apiBase+"/user/emails", accessToken, githubAcceptHeader)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %s", errGithubEmailsUnavailable, err)
+	}
+	var emails []githubEmail
+	if err := json.Unmarshal(bEmails, &emails); err != nil {
+		return Identity{}, fmt.Errorf("failed to unmarshal github emails: %w", err)
+	}
+	email, ok := primaryVerifiedEmail(emails)
+	if !ok {
+		return Identity{}, &GithubEmailError{Login: user.Login}
+	}
+
+	sub := strconv.FormatInt(user.Id, 10)
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+
+	return Identity{
+		Subject:       sub,
+		Email:         email,
+		EmailVerified: true,
+		Name:          name,
+		Claims: StandardClaims{
+			Sub:               sub,
+			Name:              user.Name,
+			PreferredUsername: user.Login,
+			Picture:           user.AvatarUrl,
+			Profile:           user.HtmlUrl,
+			Email:             email,
+			EmailVerified:     true,
+			Raw:               raw,
+		},
+	}, nil
+}
+
+func primaryVerifiedEmail(emails []githubEmail) (string, bool) {
+	for _, v := range emails {
+		if v.Primary && v.Verified {
+			return v.Email, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,126 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newGithubTestServer(t *testing.T, user string, emails string, emailsStatus int) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/login/oauth/access_token" {
+			_, _ = fmt.Fprint(w, `{"access_token": "DummyAccessToken", "token_type": "bearer"}`)
+
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer DummyAccessToken" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		switch r.URL.Path {
+		case "/user":
+			_, _ = fmt.Fprint(w, user)
+		case "/user/emails":
+			w.WriteHeader(emailsStatus)
+			_, _ = fmt.Fprint(w, emails)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOauth2Client_Exchange_Github(t *testing.T) {
+	const user = `{"id": 583231, "login": "octocat", "name": "The Octocat", "avatar_url": "https://example.com/a.png"}`
+
+	patterns := []struct {
+		desc          string
+		expected      error
+		user          string
+		emails        string
+		emailsStatus  int
+		expectedEmail string
+		expectedName  string
+	}{
+		{
+			"確認済みのプライマリのメールアドレスを使う",
+			nil,
+			user,
+			`[{"email": "other@example.com", "primary": false, "verified": true},
+  {"email": "octocat@github.com", "primary": true, "verified": true}]`,
+			http.StatusOK,
+			"octocat@github.com",
+			"The Octocat",
+		},
+		{
+			"nameが無い場合はlogin",
+			nil,
+			`{"id": 583231, "login": "octocat"}`,
+			`[{"email": "octocat@github.com", "primary": true, "verified": true}]`,
+			http.StatusOK,
+			"octocat@github.com",
+			"octocat",
+		},
+		{
+			"プライマリが未確認",
+			errGithubNoVerifiedEmail,
+			user,
+			`[{"email": "octocat@github.com", "primary": true, "verified": false}]`,
+			http.StatusOK,
+			"",
+			"",
+		},
+		{
+			"user:emailが許可されていない",
+			errGithubEmailsUnavailable,
+			user,
+			`{"message": "Not Found"}`,
+			http.StatusNotFound,
+			"",
+			"",
+		},
+		{
+			"idが無い",
+			errGithubIdMissing,
+			`{"login": "octocat"}`,
+			`[]`,
+			http.StatusOK,
+			"",
+			"",
+		},
+	}
+
+	for _, pattern := range patterns {
+		server := newGithubTestServer(t, pattern.user, pattern.emails, pattern.emailsStatus)
+		client := newGithubClient("client-id", "client-secret", server.URL)
+		client.oauth.tokenEndpoint = server.URL + "/login/oauth/access_token"
+
+		identity, err := client.Exchange(context.Background(), "code", "https://rp.example.com/cb", "", "")
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+			assert.Equal(t, "583231", identity.Subject, pattern.desc)
+			assert.Equal(t, pattern.expectedEmail, identity.Email, pattern.desc)
+			assert.True(t, identity.EmailVerified, pattern.desc)
+			assert.Equal(t, pattern.expectedName, identity.Name, pattern.desc)
+			assert.Equal(t, "octocat", identity.Claims.PreferredUsername, pattern.desc)
+			assert.Equal(t, GitHub, identity.IdProvider, pattern.desc)
+			assert.Equal(t, "DummyAccessToken", identity.Token.AccessToken, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+		if pattern.expected == errGithubNoVerifiedEmail {
+			// ハンドラでユーザーに確認を促せるように型で区別する
+			var emailErr *GithubEmailError
+			assert.ErrorAs(t, err, &emailErr, pattern.desc)
+		}
+
+		server.Close()
+	}
+}
@@ -1,7 +1,8 @@
 package oidc
 
 import (
-	"time"
+	"fmt"
+	"strings"
 )
 
 var (
@@ -9,43 +10,44 @@ var (
 	googleIssuers = [2]string{"https://accounts.google.com", "accounts.google.com"}
 )
 
+// HostedDomainError はGoogle Workspaceのドメイン(hd)が許可されていないid_tokenを拒否したことを表すエラー
+//
+// 個人のGoogleアカウントのid_tokenにはhdが含まれないので、Hdは空文字になる
+type HostedDomainError struct {
+	Hd      string
+	Allowed []string
+}
+
+func (e *HostedDomainError) Error() string {
+	if e.Hd == "" {
+		return fmt.Sprintf("hd claim missing, allowed: %s", strings.Join(e.Allowed, ","))
+	}
+
+	return fmt.Sprintf("hosted domain %s is not allowed, allowed: %s", e.Hd, strings.Join(e.Allowed, ","))
+}
+
 // googleIdTokenPayload はトークンエンドポイントのレスポンスの中のid_tokenのpayloadをunmarshalするための構造体
 type googleIdTokenPayload struct {
-	Iss string `json:"iss"`
-	// クライアントID
-	Aud string `json:"aud"`
-	// ID Provider内でのID。メアドではなくこちらがユーザー識別子となる
-	Sub   string `json:"sub"`
-	Email string `json:"email"`
-	Exp   int64  `json:"exp"`
+	StandardClaims
+	// Hd はユーザーが所属するGoogle Workspaceのドメイン。個人のGoogleアカウントでは含まれない
+	Hd string `json:"hd"`
 }
 
 // Validate はpayloadの中身を検証
 //
-// - Issuer
-//
-// - Audience
-//
-// - Expiration
-//
-// を確認する
-func (payload googleIdTokenPayload) validate(clientId string) error {
-	if err := payload.validateIss(); err != nil {
+// Googleはissuerが2種類あるので、Issuerの確認だけを差し替える
+func (payload googleIdTokenPayload) validate(params ValidationParams) error {
+	if err := payload.validateIss(params.Issuer); err != nil {
 		return err
 	}
-
-	if err := payload.validateAud(clientId); err != nil {
+	if err := payload.validateHostedDomain(params.AllowedHostedDomains); err != nil {
 		return err
 	}
 
-	if err := payload.validateExp(); err != nil {
-		return err
-	}
-
-	return nil
+	return payload.validateClaims(params)
 }
 
-func (payload googleIdTokenPayload) validateIss() error {
+func (payload googleIdTokenPayload) validateIss(_ string) error {
 	isValid := false
 	for _, v := range googleIssuers {
 		if payload.Iss == v {
@@ -60,29 +62,19 @@ func (payload googleIdTokenPayload) validateIss() error {
 	}
 }
 
-func (payload googleIdTokenPayload) validateAud(clientId string) error {
-	if payload.Aud != clientId {
-		return errAudMismatch
+// validateHostedDomain はhdクレームが許可されたドメインのどれかと一致するかを確認する
+//
+// 認可リクエストのhdはログイン画面のヒントでしかなくユーザーが書き換えられるので、必ずid_tokenのhdで確認する。
+// メールアドレスのドメインはWorkspaceのドメインと一致するとは限らないので使わない
+func (payload googleIdTokenPayload) validateHostedDomain(allowedDomains []string) error {
+	if len(allowedDomains) == 0 {
+		return nil
 	}
-
-	return nil
-}
-
-func (payload googleIdTokenPayload) validateExp() error {
-	if (time.Now().Unix() - payload.Exp) > 0 {
-		return errIdTokenExpired
+	for _, v := range allowedDomains {
+		if payload.Hd != "" && strings.EqualFold(payload.Hd, v) {
+			return nil
+		}
 	}
 
-	return nil
-}
-
-func (payload googleIdTokenPayload) GetSub() string {
-	return payload.Sub
-}
-
-// GetEmail はid_tokenからメールアドレスを取得する
-//
-// Googleの場合はid_tokenにメールアドレスが入っているが、IdPによっては入っていないので、UserInfo Endpointから取得する必要がある
-func (payload googleIdTokenPayload) GetEmail() (string, error) {
-	return payload.Email, nil
+	return &HostedDomainError{Hd: payload.Hd, Allowed: allowedDomains}
 }
@@ -1,6 +1,7 @@
 package oidc
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
@@ -53,15 +54,82 @@ func TestGoogleIdTokenPayload_IsValid(t *testing.T) {
 	}
 
 	for _, pattern := range patterns {
-		payload := googleIdTokenPayload{
+		payload := googleIdTokenPayload{StandardClaims: StandardClaims{
 			Iss: pattern.iss,
-			Aud: pattern.aud,
+			Aud: audience{pattern.aud},
 			Exp: pattern.exp,
-		}
+			Iat: time.Now().Unix(),
+		}}
 
-		err := payload.validate(pattern.clientId)
+		err := payload.validate(ValidationParams{ClientId: pattern.clientId})
 		actual := err == nil
 
 		assert.Equal(t, pattern.expected, actual)
 	}
 }
+
+func TestGoogleIdTokenPayload_ValidateNonce(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		expected error
+		claim    string
+		nonce    string
+	}{
+		{"一致", nil, "n-0S6_WzA2Mj", "n-0S6_WzA2Mj"},
+		{"nonceを送っていない", nil, "", ""},
+		{"不一致", errNonceMismatch, "n-0S6_WzA2Mj", "other-nonce"},
+		{"nonceクレームがない", errNonceMismatch, "", "n-0S6_WzA2Mj"},
+	}
+
+	for _, pattern := range patterns {
+		payload := googleIdTokenPayload{StandardClaims: StandardClaims{
+			Iss:   googleIssuers[0],
+			Aud:   audience{"client-id"},
+			Exp:   time.Now().Add(time.Hour).Unix(),
+			Iat:   time.Now().Unix(),
+			Nonce: pattern.claim,
+		}}
+
+		err := payload.validate(ValidationParams{ClientId: "client-id", Nonce: pattern.nonce})
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+}
+
+func TestGoogleIdTokenPayload_ValidateHostedDomain(t *testing.T) {
+	patterns := []struct {
+		desc           string
+		isExpectValid  bool
+		hd             string
+		allowedDomains []string
+	}{
+		{"許可リストなし", true, "", nil},
+		{"許可されたドメイン", true, "example.com", []string{"example.com", "example.co.jp"}},
+		{"大文字小文字は区別しない", true, "Example.com", []string{"example.com"}},
+		{"許可されていないドメイン", false, "other.com", []string{"example.com"}},
+		{"個人のアカウント", false, "", []string{"example.com"}},
+	}
+
+	for _, pattern := range patterns {
+		payload := googleIdTokenPayload{
+			StandardClaims: StandardClaims{
+				Iss: "https://accounts.google.com",
+				Aud: audience{"client-id"},
+				Exp: time.Now().Add(time.Hour).Unix(),
+				Iat: time.Now().Unix(),
+			},
+			Hd: pattern.hd,
+		}
+
+		err := payload.validate(ValidationParams{ClientId: "client-id", AllowedHostedDomains: pattern.allowedDomains})
+		assert.Equal(t, pattern.isExpectValid, err == nil, pattern.desc)
+		if !pattern.isExpectValid {
+			var hdErr *HostedDomainError
+			assert.True(t, errors.As(err, &hdErr), pattern.desc)
+			assert.Equal(t, pattern.hd, hdErr.Hd, pattern.desc)
+		}
+	}
+}
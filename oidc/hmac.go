@@ -0,0 +1,48 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// hmacAlgHS256 は共有鍵で署名するid_tokenのうち、検証に対応しているアルゴリズム
+const hmacAlgHS256 = "HS256"
+
+// isHmacAlg はalgがHMAC(HS256など)かどうか
+func isHmacAlg(alg string) bool {
+	return strings.HasPrefix(alg, "HS")
+}
+
+// validateHmacSignature はclient_secretなどの共有鍵でHS256署名されたid_tokenの署名を検証する
+//
+// 公開鍵と違い、鍵を知っていれば誰でも署名できてしまうので、allowedAlgsでHS256を明示的に許可したクライアントでのみ使う
+func (token idToken) validateHmacSignature(key []byte, allowedAlgs []string) error {
+	if token.header.Alg != hmacAlgHS256 {
+		return fmt.Errorf("%w: %s", errAlgUnsupported, token.header.Alg)
+	}
+	isAllowed := false
+	for _, v := range allowedAlgs {
+		if v == hmacAlgHS256 {
+			isAllowed = true
+		}
+	}
+	if !isAllowed {
+		return fmt.Errorf("%w: %s", errAlgNotAllowed, token.header.Alg)
+	}
+
+	decSignature, err := base64.RawURLEncoding.DecodeString(token.rawSignature)
+	if err != nil {
+		return fmt.Errorf("failed to base64 decode id_token signature: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fmt.Sprintf("%s.%s", token.rawHeader, token.RawPayload)))
+	if !hmac.Equal(mac.Sum(nil), decSignature) {
+		return fmt.Errorf("failed to verify id_token signature: %w", errInvalidSig)
+	}
+
+	return nil
+}
@@ -1,7 +1,41 @@
 package oidc
 
+import "strings"
+
 type IdProvider int
 
 const (
 	Google IdProvider = iota + 1
+	// Generic はDiscoveryから生成した、既知のどのIdPにも当てはまらないプロバイダ
+	Generic
+	Apple
+	Microsoft
+	// GitHub はid_tokenを発行しないOAuth2のプロバイダ
+	GitHub
+	Line
+	YahooJapan
 )
+
+// idProviderFromIssuer はissuerから既知のIdPを判定する
+func idProviderFromIssuer(issuer string) IdProvider {
+	for _, v := range googleIssuers {
+		if issuer == v {
+			return Google
+		}
+	}
+
+	if issuer == appleIssuer {
+		return Apple
+	}
+	switch issuer {
+	case lineIssuer:
+		return Line
+	case yahooJapanIssuer:
+		return YahooJapan
+	}
+	if strings.HasPrefix(issuer, microsoftLoginHost+"/") {
+		return Microsoft
+	}
+
+	return Generic
+}
@@ -1,10 +1,12 @@
 package oidc
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -13,6 +15,7 @@ var (
 	errIssMismatch    = errors.New("id_token issuer invalid")
 	errAudMismatch    = errors.New("id_token audience mismatch")
 	errIdTokenExpired = errors.New("id_token expired")
+	errNonceMismatch  = errors.New("id_token nonce mismatch")
 	errJwkNotFound    = errors.New("key not found on JWKs endpoint")
 )
 
@@ -26,14 +29,17 @@ type idToken struct {
 	Payload idTokenPayload
 }
 
+// idTokenPayload はid_tokenのpayload。StandardClaimsと、それを埋め込んだIdPごとの構造体が実装する
 type idTokenPayload interface {
-	validateIss() error
+	validateIss(issuer string) error
 	validateAud(clientId string) error
-	validateExp() error
-	validate(clientId string) error
+	validateTimes(params ValidationParams) error
+	validateNonce(nonce string) error
+	validate(params ValidationParams) error
+	standardClaims() *StandardClaims
 	GetSub() string
-	// GetEmail はGoogleでのみ動作する
 	GetEmail() (string, error)
+	GetClaims() StandardClaims
 }
 
 type header struct {
@@ -76,33 +82,109 @@ func NewIdToken(rawToken string, provider IdProvider) (*idToken, error) {
 }
 
 // setPayload は生のpayloadを構造体に焼き直してセットする
+//
+// IdP固有の構造体がない場合はStandardClaimsとして扱う
 func (token *idToken) setPayload() error {
-	if token.IdProvider == Google {
-		bytePayload, err := jwt.DecodeSegment(token.RawPayload)
-		if err != nil {
-			return fmt.Errorf("failed to decode payload JWT segment: %w", err)
-		}
-		payload := &googleIdTokenPayload{}
-		if err := json.Unmarshal(bytePayload, payload); err != nil {
-			return fmt.Errorf("failed to unmarshal id_token payload: %w", err)
-		}
-		token.Payload = payload
+	bytePayload, err := jwt.DecodeSegment(token.RawPayload)
+	if err != nil {
+		return fmt.Errorf("failed to decode payload JWT segment: %w", err)
+	}
 
-		return nil
+	payload := newIdTokenPayload(token.IdProvider)
+	if err := json.Unmarshal(bytePayload, payload); err != nil {
+		return fmt.Errorf("failed to unmarshal id_token payload: %w", err)
+	}
+	if err := json.Unmarshal(bytePayload, &payload.standardClaims().Raw); err != nil {
+		return fmt.Errorf("failed to unmarshal id_token payload: %w", err)
 	}
+	token.Payload = payload
 
-	return errIssMismatch
+	return nil
+}
+
+func newIdTokenPayload(provider IdProvider) idTokenPayload {
+	switch provider {
+	case Google:
+		return &googleIdTokenPayload{}
+	case Apple:
+		return &appleIdTokenPayload{}
+	case Microsoft:
+		return &microsoftIdTokenPayload{}
+	case Line:
+		return &lineIdTokenPayload{}
+	case YahooJapan:
+		return &yahooJapanIdTokenPayload{}
+	default:
+		return &StandardClaims{}
+	}
+}
+
+// ValidationParams はid_tokenの検証に使う値をまとめた構造体
+type ValidationParams struct {
+	JwksUrl string
+	// Issuer はid_tokenのissとして期待する値。IdPごとのpayloadによっては使わない
+	Issuer   string
+	ClientId string
+	// AllowedAlgs は受け入れる署名アルゴリズム。空の場合は対応している全ての非対称鍵アルゴリズムを受け入れる
+	AllowedAlgs []string
+	// Nonce は認可リクエストで送ったnonce。空の場合はnonceを送っていないものとして検証しない
+	Nonce string
+	// MaxAge は認可リクエストで送ったmax_age。0以下の場合は送っていないものとしてauth_timeを検証しない
+	MaxAge time.Duration
+	// AcrValues は認可リクエストで送ったacr_values。空の場合はacrを検証しない
+	AcrValues []string
+	// Leeway はexpやiatなどの時刻の検証で許容する時計のずれ
+	Leeway time.Duration
+	// MaxIatAge はiatから受け入れるまでに許容する時間。0以下の場合は検証しない
+	MaxIatAge time.Duration
+	// AllowedTenants はMicrosoftのid_tokenで受け入れるテナントID(tid)。空の場合は全てのテナントを受け入れる
+	AllowedTenants []string
+	// SymmetricKey はHS256で署名されたid_tokenを検証する共有鍵(LINEのチャネルシークレット)。空の場合はHMACを拒否する
+	SymmetricKey []byte
+	// AllowedHostedDomains はGoogleのid_tokenで受け入れるWorkspaceのドメイン(hd)。空の場合は全てのアカウントを受け入れる
+	AllowedHostedDomains []string
+	// Now は現在時刻を返す。nilの場合はtime.Nowを使う
+	Now func() time.Time
+}
+
+func (params ValidationParams) now() time.Time {
+	if params.Now == nil {
+		return time.Now()
+	}
+
+	return params.Now()
 }
 
 // Validate はJWTの署名とpayloadの中身を検証する
-func (token idToken) Validate(jwksUrl string, clientId string) error {
-	if err := token.validateSignature(jwksUrl); err != nil {
+func (token idToken) Validate(params ValidationParams) error {
+	if len(params.SymmetricKey) > 0 && isHmacAlg(token.header.Alg) {
+		if err := token.validateHmacSignature(params.SymmetricKey, params.AllowedAlgs); err != nil {
+			return err
+		}
+	} else if err := token.validateSignature(params.JwksUrl, params.AllowedAlgs); err != nil {
 		return err
 	}
 
-	if err := token.Payload.validate(clientId); err != nil {
+	if err := token.Payload.validate(params); err != nil {
 		return fmt.Errorf("failed to validate id_token payload: %w", err)
 	}
 
 	return nil
 }
+
+// validateNonce はid_tokenのnonceクレームが認可リクエストで送ったnonceと一致するかを確認する
+//
+// nonceを送った場合、nonceクレームが無いid_tokenも拒否する
+func validateNonce(claim string, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	if claim == "" {
+		return fmt.Errorf("%w: nonce claim missing", errNonceMismatch)
+	}
+	if subtle.ConstantTimeCompare([]byte(claim), []byte(expected)) != 1 {
+		return errNonceMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// introspectionCacheMaxSize はキャッシュするトークンの最大件数
+//
+// この件数に達したら期限切れのエントリを掃除し、それでも空かなければ期限が最も近いエントリを追い出す
+const introspectionCacheMaxSize = 1000
+
+var errIntrospectionNotSupported = errors.New("introspection endpoint not configured")
+
+// IntrospectionResult はイントロスペクションエンドポイントのレスポンス
+//
+// Activeがfalseの場合、他の項目は返されない。
+//
+// refs: https://www.rfc-editor.org/rfc/rfc7662#section-2.2
+type IntrospectionResult struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope"`
+	ClientId  string   `json:"client_id"`
+	Username  string   `json:"username"`
+	TokenType string   `json:"token_type"`
+	Exp       int64    `json:"exp"`
+	Iat       int64    `json:"iat"`
+	Nbf       int64    `json:"nbf"`
+	Sub       string   `json:"sub"`
+	Aud       audience `json:"aud"`
+	Iss       string   `json:"iss"`
+	Jti       string   `json:"jti"`
+
+	// Raw はIdP独自の項目も含めた全ての項目
+	Raw map[string]interface{} `json:"-"`
+}
+
+// HasScope はトークンにscopeが付与されているかを返す
+func (result IntrospectionResult) HasScope(scope string) bool {
+	for _, v := range strings.Fields(result.Scope) {
+		if v == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnableIntrospectionCache はIntrospectの結果をttlの間キャッシュする
+//
+// 同じアクセストークンで続けてAPIが呼ばれても、毎回イントロスペクションエンドポイントを叩かないようにする。
+// ただし失効させたトークンもttlの間は有効と判定されるので、ttlは短くすること
+func (c *oidcClient) EnableIntrospectionCache(ttl time.Duration) {
+	c.introspectionCache = &introspectionCache{
+		entries: map[[sha256.Size]byte]introspectionCacheEntry{},
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Introspect はアクセストークンが有効かどうかをIdPに問い合わせる
+//
+// 不透明なアクセストークンを受け取るAPIで、トークンを検証するのに使う
+func (c oidcClient) Introspect(ctx context.Context, token string) (IntrospectionResult, error) {
+	if c.introspectionEndpoint == "" {
+		return IntrospectionResult{}, errIntrospectionNotSupported
+	}
+	if result, ok := c.introspectionCache.get(token); ok {
+		return result, nil
+	}
+
+	values := url.Values{}
+	values.Add("token", token)
+	values.Add("token_type_hint", TokenTypeHintAccessToken)
+
+	reqWithCtx, err := c.newClientAuthRequest(ctx, c.introspectionEndpoint, values)
+	if err != nil {
+		return IntrospectionResult{}, err
+	}
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(reqWithCtx)
+	if err != nil {
+		return IntrospectionResult{}, fmt.Errorf("failed to POST introspection endpoint: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	bRespBody, err := readTokenResponseBody(resp)
+	if err != nil {
+		return IntrospectionResult{}, err
+	}
+	result, err := parseIntrospectionResponse(resp.StatusCode, bRespBody)
+	if err != nil {
+		return IntrospectionResult{}, err
+	}
+	c.introspectionCache.set(token, result)
+
+	return result, nil
+}
+
+func parseIntrospectionResponse(statusCode int, body []byte) (IntrospectionResult, error) {
+	if statusCode != http.StatusOK {
+		tokenErr := &TokenError{}
+		if err := json.Unmarshal(body, tokenErr); err != nil {
+			return IntrospectionResult{}, fmt.Errorf("%w: status %d: %v", errTokenResponseNotJson, statusCode, err)
+		}
+		tokenErr.StatusCode = statusCode
+
+		return IntrospectionResult{}, tokenErr
+	}
+
+	result := IntrospectionResult{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return IntrospectionResult{}, fmt.Errorf("%w: %v", errTokenResponseNotJson, err)
+	}
+	if err := json.Unmarshal(body, &result.Raw); err != nil {
+		return IntrospectionResult{}, fmt.Errorf("%w: %v", errTokenResponseNotJson, err)
+	}
+
+	return result, nil
+}
+
+// introspectionCache はトークンのハッシュをキーにIntrospectの結果を保持する。nilの場合はキャッシュしない
+type introspectionCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]introspectionCacheEntry
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+type introspectionCacheEntry struct {
+	result    IntrospectionResult
+	expiresAt time.Time
+}
+
+func (c *introspectionCache) get(token string) (IntrospectionResult, bool) {
+	if c == nil {
+		return IntrospectionResult{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := sha256.Sum256([]byte(token))
+	entry, ok := c.entries[key]
+	if !ok || !c.now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+
+		return IntrospectionResult{}, false
+	}
+
+	return entry.result, true
+}
+
+// set は結果をキャッシュする。有効なトークンはexpを過ぎてまでキャッシュしない
+func (c *introspectionCache) set(token string, result IntrospectionResult) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	expiresAt := now.Add(c.ttl)
+	if result.Active && result.Exp != 0 && time.Unix(result.Exp, 0).Before(expiresAt) {
+		expiresAt = time.Unix(result.Exp, 0)
+	}
+
+	key := sha256.Sum256([]byte(token))
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= introspectionCacheMaxSize {
+		c.evict(now)
+	}
+	c.entries[key] = introspectionCacheEntry{result: result, expiresAt: expiresAt}
+}
+
+// evict は期限切れのエントリを削除する。期限切れのエントリがなければ期限が最も近いエントリを削除する
+func (c *introspectionCache) evict(now time.Time) {
+	var oldestKey [sha256.Size]byte
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+
+			continue
+		}
+		if oldest.IsZero() || entry.expiresAt.Before(oldest) {
+			oldestKey, oldest = key, entry.expiresAt
+		}
+	}
+	if len(c.entries) >= introspectionCacheMaxSize {
+		delete(c.entries, oldestKey)
+	}
+}
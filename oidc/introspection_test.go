@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newIntrospectionServer(t *testing.T, exp int64) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("client_secret") != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": "invalid_client"}`))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("token") != "ActiveToken" {
+			_, _ = w.Write([]byte(`{"active": false}`))
+
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{
+  "active": true,
+  "client_id": "l238j323ds-23ij4",
+  "username": "jdoe",
+  "scope": "read write dolphin",
+  "sub": "Z5O3upPC88QrAjx00dis",
+  "aud": "https://protected.example.net/resource",
+  "iss": "https://server.example.com/",
+  "exp": %d,
+  "iat": 1419350238,
+  "extension_field": "twenty-seven"
+}`, exp)
+	}))
+
+	return server, &hits
+}
+
+func TestOidcClient_Introspect(t *testing.T) {
+	server, _ := newIntrospectionServer(t, time.Now().Add(time.Hour).Unix())
+	defer server.Close()
+	client := newOidcClient(Generic, "client-id", "client-secret", "", "", "")
+	client.introspectionEndpoint = server.URL
+
+	result, err := client.Introspect(context.Background(), "ActiveToken")
+	assert.Nil(t, err)
+	assert.True(t, result.Active)
+	assert.Equal(t, "l238j323ds-23ij4", result.ClientId)
+	assert.Equal(t, "Z5O3upPC88QrAjx00dis", result.Sub)
+	assert.Equal(t, audience{"https://protected.example.net/resource"}, result.Aud)
+	assert.True(t, result.HasScope("write"))
+	assert.False(t, result.HasScope("admin"))
+	assert.Equal(t, "twenty-seven", result.Raw["extension_field"])
+
+	result, err = client.Introspect(context.Background(), "RevokedToken")
+	assert.Nil(t, err)
+	assert.False(t, result.Active)
+
+	client.clientSecret = "wrong-secret"
+	_, err = client.Introspect(context.Background(), "ActiveToken")
+	var tokenErr *TokenError
+	assert.True(t, errors.As(err, &tokenErr))
+	assert.Equal(t, TokenErrorInvalidClient, tokenErr.Code)
+}
+
+func TestOidcClient_Introspect_Cache(t *testing.T) {
+	now := time.Now()
+	server, hits := newIntrospectionServer(t, now.Add(90*time.Second).Unix())
+	defer server.Close()
+	client := newOidcClient(Generic, "client-id", "client-secret", "", "", "")
+	client.introspectionEndpoint = server.URL
+	client.EnableIntrospectionCache(5 * time.Minute)
+	client.introspectionCache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		result, err := client.Introspect(context.Background(), "ActiveToken")
+		assert.Nil(t, err)
+		assert.True(t, result.Active)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+
+	// ttl内でもトークンのexpを過ぎたら問い合わせ直す
+	now = now.Add(2 * time.Minute)
+	_, _ = client.Introspect(context.Background(), "ActiveToken")
+	assert.Equal(t, int32(2), atomic.LoadInt32(hits))
+
+	// 無効なトークンもttlの間はキャッシュする
+	_, _ = client.Introspect(context.Background(), "RevokedToken")
+	_, _ = client.Introspect(context.Background(), "RevokedToken")
+	assert.Equal(t, int32(3), atomic.LoadInt32(hits))
+	now = now.Add(6 * time.Minute)
+	_, _ = client.Introspect(context.Background(), "RevokedToken")
+	assert.Equal(t, int32(4), atomic.LoadInt32(hits))
+}
+
+func TestIntrospectionCache_Evict(t *testing.T) {
+	now := time.Now()
+	cache := &introspectionCache{
+		entries: map[[sha256.Size]byte]introspectionCacheEntry{},
+		ttl:     time.Minute,
+		now:     func() time.Time { return now },
+	}
+
+	// 期限切れのエントリは上限に達したときに掃除する
+	cache.set("expired", IntrospectionResult{Active: true, Exp: now.Add(time.Second).Unix()})
+	now = now.Add(2 * time.Second)
+	for i := 0; i < introspectionCacheMaxSize+10; i++ {
+		cache.set(fmt.Sprintf("token%d", i), IntrospectionResult{})
+		now = now.Add(time.Millisecond)
+	}
+	assert.Equal(t, introspectionCacheMaxSize, len(cache.entries))
+	_, ok := cache.entries[sha256.Sum256([]byte("expired"))]
+	assert.False(t, ok)
+
+	// 期限切れのエントリがなければ期限が最も近いものから追い出す
+	_, ok = cache.get("token0")
+	assert.False(t, ok)
+	_, ok = cache.get(fmt.Sprintf("token%d", introspectionCacheMaxSize+9))
+	assert.True(t, ok)
+}
+
+func TestOidcClient_Introspect_NotSupported(t *testing.T) {
+	client := newOidcClient(Generic, "client-id", "", "", "", "")
+
+	_, err := client.Introspect(context.Background(), "token")
+	assert.ErrorIs(t, err, errIntrospectionNotSupported)
+}
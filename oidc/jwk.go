@@ -1,19 +1,21 @@
 package oidc
 
 import (
-	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"math/big"
-	"net/http"
 	"net/url"
-	"time"
+)
+
+var (
+	errUnsupportedKty = errors.New("unsupported jwk key type")
+	errInvalidJwk     = errors.New("invalid jwk")
 )
 
 type jwks struct {
@@ -27,35 +29,41 @@ type jwk struct {
 	Use string `json:"use"`
 	N   string `json:"n"`
 	Alg string `json:"alg"`
+	// 以下はEC(crv, x, y)とOKP(crv, x)の鍵で使う
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
 }
 
-func (token idToken) validateSignature(jwksUrl string) error {
-	key, err := token.getJwk(jwksUrl)
+// validateSignature はheaderのalgに応じてJWTの署名を検証する
+//
+// algがallowedAlgsに含まれ、かつ鍵のkty/alg/useと矛盾しないことを確認してから検証する
+func (token idToken) validateSignature(jwksUrl string, allowedAlgs []string) error {
+	alg, err := findAlgorithm(token.header.Alg, allowedAlgs)
 	if err != nil {
 		return err
 	}
 
-	byteN, err := base64.RawURLEncoding.DecodeString(key.N)
+	key, err := token.getJwk(jwksUrl)
 	if err != nil {
-		return fmt.Errorf("failed to decode base64 modulus: %w", err)
+		return err
 	}
-
-	const standardExponent = 65537
-	pubKey := &rsa.PublicKey{
-		N: new(big.Int).SetBytes(byteN),
-		E: standardExponent, // TODO: key.E -> "AQAB"から導きたい
+	if err := key.checkUsableFor(alg); err != nil {
+		return err
 	}
 
-	headerAndPayload := fmt.Sprintf("%s.%s", token.rawHeader, token.RawPayload)
-	sha := sha256.New()
-	sha.Write([]byte(headerAndPayload))
+	pubKey, err := key.publicKey()
+	if err != nil {
+		return err
+	}
 
 	decSignature, err := base64.RawURLEncoding.DecodeString(token.rawSignature)
 	if err != nil {
 		return fmt.Errorf("failed to base64 decode id_token signature: %w", err)
 	}
 
-	if err := rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, sha.Sum(nil), decSignature); err != nil {
+	signingInput := []byte(fmt.Sprintf("%s.%s", token.rawHeader, token.RawPayload))
+	if err := alg.verify(pubKey, signingInput, decSignature); err != nil {
 		return fmt.Errorf("failed to verify id_token signature: %w", err)
 	}
 
@@ -63,43 +71,11 @@ func (token idToken) validateSignature(jwksUrl string) error {
 }
 
 func (token idToken) getJwk(jwksUrl string) (jwk, error) {
-	parsedUrl, err := url.Parse(jwksUrl)
-	if err != nil {
+	if _, err := url.Parse(jwksUrl); err != nil {
 		return jwk{}, fmt.Errorf("failed to parse jwks url: %w", err)
 	}
 
-	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), httpTimeoutSec*time.Second)
-	defer cancel()
-	reqWithCtx, err := http.NewRequestWithContext(ctxWithTimeout, http.MethodGet, parsedUrl.String(), nil)
-	if err != nil {
-		return jwk{}, fmt.Errorf("failed to create request of GET JWKs endpoint: %w", err)
-	}
-
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(reqWithCtx)
-	if err != nil {
-		return jwk{}, fmt.Errorf("failed to GET JWKs endpoint: %w", err)
-	}
-
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(resp.Body)
-	byteArray, _ := ioutil.ReadAll(resp.Body)
-
-	keys := &jwks{}
-	if err := json.Unmarshal(byteArray, keys); err != nil {
-		return jwk{}, fmt.Errorf("failed to unmarshal JWKs response: %w", err)
-	}
-
-	foundKey, err := keys.find(token.header.Kid)
-	if err != nil {
-		return jwk{}, err
-	}
-
-	return foundKey, nil
+	return defaultJwksCache.getKey(jwksUrl, token.header.Kid)
 }
 
 func (keys jwks) find(kid string) (jwk, error) {
@@ -118,3 +94,105 @@ func (keys jwks) find(kid string) (jwk, error) {
 		return jwk{}, errJwkNotFound
 	}
 }
+
+// checkUsableFor は鍵がalgの署名検証に使えるかを確認する
+func (key jwk) checkUsableFor(alg algorithm) error {
+	if key.Kty != alg.kty {
+		return fmt.Errorf("%w: alg %s, kty %s", errAlgKeyMismatch, alg.name, key.Kty)
+	}
+	if key.Alg != "" && key.Alg != alg.name {
+		return fmt.Errorf("%w: alg %s, jwk alg %s", errAlgKeyMismatch, alg.name, key.Alg)
+	}
+	if key.Use != "" && key.Use != "sig" {
+		return fmt.Errorf("%w: use %s", errAlgKeyMismatch, key.Use)
+	}
+	if alg.crv != "" && key.Crv != alg.crv {
+		return fmt.Errorf("%w: alg %s, crv %s", errAlgKeyMismatch, alg.name, key.Crv)
+	}
+
+	return nil
+}
+
+// publicKey はktyに応じてJWKを公開鍵に変換する
+func (key jwk) publicKey() (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		return key.rsaPublicKey()
+	case "EC":
+		return key.ecdsaPublicKey()
+	case "OKP":
+		return key.ed25519PublicKey()
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedKty, key.Kty)
+	}
+}
+
+func (key jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	byteN, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 modulus: %w", err)
+	}
+	byteE, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 exponent: %w", err)
+	}
+
+	// eはビッグエンディアンの符号なし整数。"AQAB"は[0x01, 0x00, 0x01]、つまり65537
+	const maxExponent = 1<<31 - 1
+	e := new(big.Int).SetBytes(byteE)
+	if len(byteN) == 0 || !e.IsInt64() || e.Int64() < 2 || e.Int64() > maxExponent {
+		return nil, fmt.Errorf("%w: invalid RSA modulus or exponent", errInvalidJwk)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(byteN),
+		E: int(e.Int64()),
+	}, nil
+}
+
+func (key jwk) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch key.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("%w: unsupported crv %s", errInvalidJwk, key.Crv)
+	}
+
+	byteX, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 x coordinate: %w", err)
+	}
+	byteY, err := base64.RawURLEncoding.DecodeString(key.Y)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 y coordinate: %w", err)
+	}
+
+	x := new(big.Int).SetBytes(byteX)
+	y := new(big.Int).SetBytes(byteY)
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("%w: point is not on curve %s", errInvalidJwk, key.Crv)
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func (key jwk) ed25519PublicKey() (ed25519.PublicKey, error) {
+	if key.Crv != "Ed25519" {
+		return nil, fmt.Errorf("%w: unsupported crv %s", errInvalidJwk, key.Crv)
+	}
+
+	byteX, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 x coordinate: %w", err)
+	}
+	if len(byteX) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: invalid Ed25519 public key size", errInvalidJwk)
+	}
+
+	return ed25519.PublicKey(byteX), nil
+}
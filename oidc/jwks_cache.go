@@ -0,0 +1,187 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultJwksTtl はCache-ControlもExpiresも返されなかった場合のキャッシュ期間
+	defaultJwksTtl = 5 * time.Minute
+	// jwksRefreshInterval は未知のkidによる再取得を許す最短間隔
+	jwksRefreshInterval = 1 * time.Minute
+)
+
+var errJwksUnavailable = errors.New("JWKs endpoint unavailable")
+
+// defaultJwksCache はidToken.Validateが使うプロセス共通のキャッシュ
+var defaultJwksCache = newJwksCache()
+
+// jwksCache はJWKsエンドポイントのURLごとに鍵セットを保持する
+//
+// 毎回のログインでJWKsエンドポイントを叩かないように、Cache-Control: max-ageまたはExpiresの間は鍵を使い回す。
+// 未知のkidが来た場合はIdPが鍵をローテーションした可能性があるので、一度だけ再取得する。
+type jwksCache struct {
+	mu              sync.Mutex
+	entries         map[string]*jwksCacheEntry
+	now             func() time.Time
+	refreshInterval time.Duration
+}
+
+type jwksCacheEntry struct {
+	keys        jwks
+	expiresAt   time.Time
+	lastFetched time.Time
+	// inflight は取得中のリクエスト。同時に来た取得要求はこれを待つ
+	inflight *jwksFetchCall
+}
+
+type jwksFetchCall struct {
+	done      chan struct{}
+	keys      jwks
+	expiresAt time.Time
+	err       error
+}
+
+func newJwksCache() *jwksCache {
+	return &jwksCache{
+		entries:         map[string]*jwksCacheEntry{},
+		now:             time.Now,
+		refreshInterval: jwksRefreshInterval,
+	}
+}
+
+// getKey はkidに一致する鍵を返す
+//
+// キャッシュが期限切れの場合、またはkidが見つからずレートリミットに掛からない場合はJWKsエンドポイントから再取得する。
+// 再取得に失敗した場合は、最後に取得できた鍵セットを使い続ける。
+func (c *jwksCache) getKey(jwksUrl string, kid string) (jwk, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[jwksUrl]
+	if !ok {
+		entry = &jwksCacheEntry{}
+		c.entries[jwksUrl] = entry
+	}
+
+	now := c.now()
+	// expiresAtは取得に成功した場合のみセットされる
+	hasKeys := !entry.expiresAt.IsZero()
+	if hasKeys && now.Before(entry.expiresAt) {
+		key, err := entry.keys.find(kid)
+		if err == nil || now.Sub(entry.lastFetched) < c.refreshInterval {
+			c.mu.Unlock()
+
+			return key, err
+		}
+	}
+	call := c.startFetch(jwksUrl, entry)
+	c.mu.Unlock()
+
+	<-call.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call.err != nil {
+		if !hasKeys {
+			return jwk{}, fmt.Errorf("%w: %s", errJwksUnavailable, call.err)
+		}
+
+		return entry.keys.find(kid)
+	}
+
+	return call.keys.find(kid)
+}
+
+// startFetch は取得中のリクエストがあればそれを返し、なければ新たに取得を開始する。c.muをロックした状態で呼ぶこと
+func (c *jwksCache) startFetch(jwksUrl string, entry *jwksCacheEntry) *jwksFetchCall {
+	if entry.inflight != nil {
+		return entry.inflight
+	}
+
+	call := &jwksFetchCall{done: make(chan struct{})}
+	entry.inflight = call
+	go func() {
+		call.keys, call.expiresAt, call.err = fetchJwks(jwksUrl, c.now)
+
+		c.mu.Lock()
+		entry.inflight = nil
+		entry.lastFetched = c.now()
+		if call.err == nil {
+			entry.keys = call.keys
+			entry.expiresAt = call.expiresAt
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	return call
+}
+
+// fetchJwks はJWKsエンドポイントから鍵セットを取得し、レスポンスヘッダからキャッシュの有効期限を求める
+func fetchJwks(jwksUrl string, now func() time.Time) (jwks, time.Time, error) {
+	ctxWithTimeout, cancel := context.WithTimeout(context.Background(), httpTimeoutSec*time.Second)
+	defer cancel()
+	reqWithCtx, err := http.NewRequestWithContext(ctxWithTimeout, http.MethodGet, jwksUrl, nil)
+	if err != nil {
+		return jwks{}, time.Time{}, fmt.Errorf("failed to create request of GET JWKs endpoint: %w", err)
+	}
+
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(reqWithCtx)
+	if err != nil {
+		return jwks{}, time.Time{}, fmt.Errorf("failed to GET JWKs endpoint: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return jwks{}, time.Time{}, fmt.Errorf("unexpected status of JWKs endpoint: %d", resp.StatusCode)
+	}
+	byteArray, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return jwks{}, time.Time{}, fmt.Errorf("failed to read JWKs response: %w", err)
+	}
+
+	keys := &jwks{}
+	if err := json.Unmarshal(byteArray, keys); err != nil {
+		return jwks{}, time.Time{}, fmt.Errorf("failed to unmarshal JWKs response: %w", err)
+	}
+
+	return *keys, cacheExpiry(resp.Header, now()), nil
+}
+
+// cacheExpiry はCache-Control: max-age、なければExpiresからキャッシュの有効期限を求める
+func cacheExpiry(h http.Header, now time.Time) time.Time {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(strings.ToLower(directive))
+		if directive == "no-store" || directive == "no-cache" {
+			return now
+		}
+		if strings.HasPrefix(directive, "max-age=") {
+			maxAge, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil && maxAge >= 0 {
+				return now.Add(time.Duration(maxAge) * time.Second)
+			}
+		}
+	}
+
+	if expires := h.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// 不正なExpiresは期限切れとして扱う
+			return now
+		}
+
+		return t
+	}
+
+	return now.Add(defaultJwksTtl)
+}
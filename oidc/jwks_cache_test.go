@@ -0,0 +1,166 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type jwksTestServer struct {
+	*httptest.Server
+	hits         int32
+	body         atomic.Value
+	cacheControl string
+	fail         int32
+}
+
+func newJwksTestServer(body string, cacheControl string) *jwksTestServer {
+	s := &jwksTestServer{cacheControl: cacheControl}
+	s.body.Store(body)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.hits, 1)
+		if atomic.LoadInt32(&s.fail) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+		if s.cacheControl != "" {
+			w.Header().Set("Cache-Control", s.cacheControl)
+		}
+		_, _ = w.Write([]byte(s.body.Load().(string)))
+	}))
+
+	return s
+}
+
+const (
+	testJwksKid1 = `{"keys": [{"kty": "RSA", "kid": "kid1", "n": "AQAB", "e": "AQAB"}]}`
+	testJwksKid2 = `{"keys": [{"kty": "RSA", "kid": "kid1", "n": "AQAB", "e": "AQAB"}, {"kty": "RSA", "kid": "kid2", "n": "AQAB", "e": "AQAB"}]}`
+)
+
+func newTestJwksCache(now *time.Time) *jwksCache {
+	c := newJwksCache()
+	c.now = func() time.Time { return *now }
+
+	return c
+}
+
+func TestJwksCache_GetKey_HonoursMaxAge(t *testing.T) {
+	server := newJwksTestServer(testJwksKid1, "public, max-age=60")
+	defer server.Close()
+	now := time.Now()
+	cache := newTestJwksCache(&now)
+
+	for i := 0; i < 3; i++ {
+		key, err := cache.getKey(server.URL, "kid1")
+		assert.Nil(t, err)
+		assert.Equal(t, "kid1", key.Kid)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.hits))
+
+	// max-ageを過ぎたら再取得する
+	now = now.Add(61 * time.Second)
+	_, err := cache.getKey(server.URL, "kid1")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.hits))
+}
+
+func TestJwksCache_GetKey_RefreshOnUnknownKid(t *testing.T) {
+	server := newJwksTestServer(testJwksKid1, "max-age=3600")
+	defer server.Close()
+	now := time.Now()
+	cache := newTestJwksCache(&now)
+
+	_, err := cache.getKey(server.URL, "kid1")
+	assert.Nil(t, err)
+
+	// 直後の未知のkidはレートリミットにより再取得しない
+	server.body.Store(testJwksKid2)
+	_, err = cache.getKey(server.URL, "kid2")
+	assert.ErrorIs(t, err, errJwkNotFound)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.hits))
+
+	// 間隔を空ければ一度だけ再取得して見つける
+	now = now.Add(jwksRefreshInterval)
+	key, err := cache.getKey(server.URL, "kid2")
+	assert.Nil(t, err)
+	assert.Equal(t, "kid2", key.Kid)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.hits))
+}
+
+func TestJwksCache_GetKey_ServesStaleOnFailure(t *testing.T) {
+	server := newJwksTestServer(testJwksKid1, "max-age=60")
+	defer server.Close()
+	now := time.Now()
+	cache := newTestJwksCache(&now)
+
+	_, err := cache.getKey(server.URL, "kid1")
+	assert.Nil(t, err)
+
+	atomic.StoreInt32(&server.fail, 1)
+	now = now.Add(2 * time.Minute)
+	key, err := cache.getKey(server.URL, "kid1")
+	assert.Nil(t, err)
+	assert.Equal(t, "kid1", key.Kid)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.hits))
+}
+
+func TestJwksCache_GetKey_Unavailable(t *testing.T) {
+	server := newJwksTestServer(testJwksKid1, "max-age=60")
+	defer server.Close()
+	atomic.StoreInt32(&server.fail, 1)
+	now := time.Now()
+	cache := newTestJwksCache(&now)
+
+	// 鍵を一度も取得できていない場合は、id_tokenの拒否ではなく通信の失敗として扱う
+	_, err := cache.getKey(server.URL, "kid1")
+	assert.ErrorIs(t, err, errJwksUnavailable)
+	var validationErr *ValidationError
+	assert.False(t, errors.As(validationError(err), &validationErr))
+}
+
+func TestJwksCache_GetKey_DeduplicatesConcurrentFetches(t *testing.T) {
+	server := newJwksTestServer(testJwksKid1, "max-age=60")
+	defer server.Close()
+	cache := newJwksCache()
+
+	const goroutines = 20
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			_, err := cache.getKey(server.URL, "kid1")
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.hits))
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	patterns := []struct {
+		desc     string
+		header   http.Header
+		expected time.Time
+	}{
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=19204, must-revalidate"}}, now.Add(19204 * time.Second)},
+		{"no-store", http.Header{"Cache-Control": {"no-store"}}, now},
+		{"Expires", http.Header{"Expires": {"Sun, 01 May 2022 01:00:00 GMT"}}, now.Add(time.Hour)},
+		{"不正なExpires", http.Header{"Expires": {"0"}}, now},
+		{"ヘッダなし", http.Header{}, now.Add(defaultJwksTtl)},
+	}
+
+	for _, pattern := range patterns {
+		assert.True(t, pattern.expected.Equal(cacheExpiry(pattern.header, now)), pattern.desc)
+	}
+}
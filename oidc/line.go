@@ -0,0 +1,67 @@
+package oidc
+
+import (
+	"net/url"
+	"os"
+)
+
+// refs: https://developers.line.biz/ja/docs/line-login/verify-id-token/
+const lineIssuer = "https://access.line.me"
+
+// LINEのid_tokenのamrの値。ユーザーがどの方法で認証したか。Identity.HasAmrで確認する
+//
+// refs: https://developers.line.biz/ja/reference/line-login/#verify-id-token
+const (
+	LineAmrPassword  = "pwd"
+	LineAmrAutoLogin = "lineautologin"
+	LineAmrQrCode    = "lineqr"
+	LineAmrSso       = "linesso"
+	LineAmrMfa       = "mfa"
+)
+
+// NewLineOidcClient はLINEログインのクライアントを返す
+//
+// LINE_CHANNEL_IDとLINE_CHANNEL_SECRETにはLINE DevelopersのLINEログインチャネルの値を設定する。
+// ウェブログインのid_tokenはチャネルシークレットでHS256署名されるので、チャネルシークレットで検証する
+func NewLineOidcClient() *oidcClient {
+	return newLineOidcClient(os.Getenv("LINE_CHANNEL_ID"), clientSecret(os.Getenv("LINE_CHANNEL_SECRET")))
+}
+
+func newLineOidcClient(channelId string, channelSecret clientSecret) *oidcClient {
+	client := newOidcClient(
+		Line,
+		channelId,
+		channelSecret,
+		"https://access.line.me/oauth2/v2.1/authorize",
+		"https://api.line.me/oauth2/v2.1/token",
+		"https://api.line.me/oauth2/v2.1/certs",
+	)
+	client.Issuer = lineIssuer
+	// LINEはRFC 7009のtokenではなくaccess_tokenでアクセストークンを受け取り、リフレッシュトークンは返却できない
+	//
+	// refs: https://developers.line.biz/ja/reference/line-login/#revoke-access-token
+	client.revocationEndpoint = "https://api.line.me/oauth2/v2.1/revoke"
+	client.revocationTokenParam = "access_token"
+	client.refreshTokenNotRevocable = true
+	// ネイティブアプリやPKCEを使った場合はES256で署名されることがある
+	client.allowedAlgs = []string{hmacAlgHS256, "ES256"}
+	client.verifyIdTokenWithSecret = true
+
+	return client
+}
+
+// WithPrompt はログイン画面の表示方法(prompt)を付与する
+//
+// LINEでメールアドレスの提供を断ったユーザーに、もう一度同意画面を出すにはprompt=consentを使う
+func WithPrompt(prompt string) AuthOption {
+	return func(values url.Values) {
+		values.Set("prompt", prompt)
+	}
+}
+
+// lineIdTokenPayload はLINEのid_tokenのpayloadをunmarshalするための構造体
+//
+// emailはチャネルでメールアドレス取得権限を申請済みで、かつユーザーが提供に同意した場合のみ含まれる
+type lineIdTokenPayload struct {
+	StandardClaims
+}
@@ -0,0 +1,99 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hmacTestToken(t *testing.T, alg string, key string, payload string) *idToken {
+	t.Helper()
+
+	signingInput := b64([]byte(fmt.Sprintf(`{"alg": "%s", "typ": "JWT"}`, alg))) + "." + b64([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(signingInput))
+
+	token, err := NewIdToken(signingInput+"."+b64(mac.Sum(nil)), Line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestIdToken_Validate_Line(t *testing.T) {
+	now := time.Now().Unix()
+	payload := fmt.Sprintf(`{
+  "iss": "https://access.line.me",
+  "sub": "U1234567890abcdef1234567890abcdef",
+  "aud": "1234567890",
+  "exp": %d,
+  "iat": %d,
+  "nonce": "nonce-value",
+  "amr": ["pwd"],
+  "name": "Taro Line",
+  "email": "taro.line@example.com"
+}`, now+600, now)
+
+	patterns := []struct {
+		desc     string
+		expected error
+		token    *idToken
+		client   *oidcClient
+	}{
+		{
+			"チャネルシークレットで署名",
+			nil,
+			hmacTestToken(t, "HS256", "channel-secret", payload),
+			newLineOidcClient("1234567890", "channel-secret"),
+		},
+		{
+			"別のシークレットで署名",
+			errInvalidSig,
+			hmacTestToken(t, "HS256", "other-secret", payload),
+			newLineOidcClient("1234567890", "channel-secret"),
+		},
+		{
+			"HS256以外のHMAC",
+			errAlgUnsupported,
+			hmacTestToken(t, "HS512", "channel-secret", payload),
+			newLineOidcClient("1234567890", "channel-secret"),
+		},
+		{
+			"LINE以外のクライアントはHMACを拒否する",
+			errAlgSymmetric,
+			hmacTestToken(t, "HS256", "channel-secret", payload),
+			newOidcClient(Generic, "1234567890", "channel-secret", "", "", ""),
+		},
+	}
+
+	for _, pattern := range patterns {
+		pattern.client.Issuer = lineIssuer
+		params := pattern.client.ValidationParams()
+		params.Nonce = "nonce-value"
+
+		err := pattern.token.Validate(params)
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+
+	token := hmacTestToken(t, "HS256", "channel-secret", payload)
+	identity := Identity{Claims: token.Payload.GetClaims()}
+	assert.True(t, identity.HasAmr(LineAmrPassword))
+	assert.False(t, identity.HasAmr(LineAmrMfa))
+	assert.Equal(t, "taro.line@example.com", token.Payload.GetClaims().Email)
+}
+
+func TestWithPrompt(t *testing.T) {
+	client := newLineOidcClient("1234567890", "channel-secret")
+
+	authUrl := client.AuthUrl("code", []string{"openid"}, "https://rp.example.com/cb", "state", WithPrompt("consent"))
+	assert.Contains(t, authUrl, "&prompt=consent")
+}
@@ -0,0 +1,162 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	microsoftLoginHost = "https://login.microsoftonline.com"
+	// microsoftIssuerTemplate はマルチテナントのエンドポイントのissuer。{tenantid}はid_tokenのtidに置き換えて比較する
+	//
+	// refs: https://learn.microsoft.com/en-us/entra/identity-platform/access-tokens#validate-the-issuer
+	microsoftIssuerTemplate = microsoftLoginHost + "/{tenantid}/v2.0"
+	tenantIdPlaceholder     = "{tenantid}"
+)
+
+var (
+	errTidMissing = errors.New("tid claim missing")
+	errOidMissing = errors.New("oid claim missing")
+)
+
+// TenantError はMICROSOFT_ALLOWED_TENANTSで許可していないテナントのid_tokenを拒否したことを表すエラー
+type TenantError struct {
+	Tid     string
+	Allowed []string
+}
+
+func (e *TenantError) Error() string {
+	return fmt.Sprintf("tenant %s is not allowed, allowed: %s", e.Tid, strings.Join(e.Allowed, ","))
+}
+
+// MicrosoftIdentity はMicrosoftのid_tokenから得たユーザーの情報
+type MicrosoftIdentity struct {
+	// TenantId はユーザーが所属するテナントのID(tid)
+	TenantId string
+	// ObjectId はテナント内でユーザーを一意に識別するオブジェクトID(oid)
+	ObjectId string
+	// Upn はユーザープリンシパル名。ゲストユーザーなどでは空のことがある
+	Upn string
+}
+
+// NewMicrosoftOidcClient はMicrosoft Entra ID(Azure AD)のv2.0エンドポイントのクライアントを返す
+//
+// MICROSOFT_TENANTにはcommon, organizations, consumersかテナントIDを設定する。省略した場合はcommon。
+// MICROSOFT_ALLOWED_TENANTSにカンマ区切りでテナントIDを設定すると、それ以外のテナントのユーザーを拒否する
+func NewMicrosoftOidcClient() *oidcClient {
+	tenant := os.Getenv("MICROSOFT_TENANT")
+	if tenant == "" {
+		tenant = "common"
+	}
+	client := newMicrosoftOidcClient(
+		tenant,
+		os.Getenv("MICROSOFT_CLIENT_ID"),
+		clientSecret(os.Getenv("MICROSOFT_CLIENT_SECRET")),
+	)
+	if allowed := os.Getenv("MICROSOFT_ALLOWED_TENANTS"); allowed != "" {
+		client.SetAllowedTenants(strings.Split(allowed, ","))
+	}
+
+	return client
+}
+
+func newMicrosoftOidcClient(tenant string, clientId string, secret clientSecret) *oidcClient {
+	base := fmt.Sprintf("%s/%s", microsoftLoginHost, tenant)
+	client := newOidcClient(
+		Microsoft,
+		clientId,
+		secret,
+		base+"/oauth2/v2.0/authorize",
+		base+"/oauth2/v2.0/token",
+		base+"/discovery/v2.0/keys",
+	)
+	client.Issuer = microsoftIssuerTemplate
+	client.userinfoEndpoint = "https://graph.microsoft.com/oidc/userinfo"
+	// refs: https://login.microsoftonline.com/common/v2.0/.well-known/openid-configuration
+	client.allowedAlgs = []string{"RS256"}
+
+	return client
+}
+
+// SetAllowedTenants はid_tokenで受け入れるテナントID(tid)を設定する
+func (c *oidcClient) SetAllowedTenants(tenantIds []string) {
+	c.allowedTenants = nil
+	for _, v := range tenantIds {
+		if v = strings.TrimSpace(v); v != "" {
+			c.allowedTenants = append(c.allowedTenants, v)
+		}
+	}
+}
+
+// microsoftIdTokenPayload はMicrosoftのid_tokenのpayloadをunmarshalするための構造体
+//
+// refs: https://learn.microsoft.com/en-us/entra/identity-platform/id-token-claims-reference
+type microsoftIdTokenPayload struct {
+	StandardClaims
+	// Oid はテナント内でユーザーを一意に識別するオブジェクトID。アプリをまたいでも変わらない
+	Oid string `json:"oid"`
+	// Tid はユーザーが所属するテナントのID
+	Tid string `json:"tid"`
+	// Upn はユーザープリンシパル名。ゲストユーザーなどでは含まれないことがある
+	Upn string `json:"upn"`
+}
+
+// validate はpayloadの中身を検証
+//
+// マルチテナントのエンドポイントではissにテナントIDが含まれるので、Issuerの確認だけを差し替える
+func (payload microsoftIdTokenPayload) validate(params ValidationParams) error {
+	if err := payload.validateIss(params.Issuer); err != nil {
+		return err
+	}
+	if err := payload.validateTenant(params.AllowedTenants); err != nil {
+		return err
+	}
+	if payload.Oid == "" {
+		return errOidMissing
+	}
+
+	return payload.validateClaims(params)
+}
+
+// validateIss はissuerのテンプレートの{tenantid}をtidクレームに置き換えてからissと比較する
+func (payload microsoftIdTokenPayload) validateIss(issuer string) error {
+	if !strings.Contains(issuer, tenantIdPlaceholder) {
+		return payload.StandardClaims.validateIss(issuer)
+	}
+	if payload.Tid == "" {
+		return errTidMissing
+	}
+
+	return payload.StandardClaims.validateIss(strings.Replace(issuer, tenantIdPlaceholder, payload.Tid, 1))
+}
+
+func (payload microsoftIdTokenPayload) validateTenant(allowedTenants []string) error {
+	if len(allowedTenants) == 0 {
+		return nil
+	}
+	for _, v := range allowedTenants {
+		if strings.EqualFold(payload.Tid, v) {
+			return nil
+		}
+	}
+
+	return &TenantError{Tid: payload.Tid, Allowed: allowedTenants}
+}
+
+// GetUserKey はユーザーを識別するキーとしてtidとoidの組を返す
+//
+// Microsoftのsubはアプリごとに異なる値になるので、ユーザーの識別にはoidとtidを使う
+func (payload microsoftIdTokenPayload) GetUserKey() string {
+	return payload.Tid + ":" + payload.Oid
+}
+
+// extendIdentity はtid, oid, upnをIdentityのMicrosoftにセットする
+func (payload microsoftIdTokenPayload) extendIdentity(identity *Identity) {
+	identity.Microsoft = MicrosoftIdentity{
+		TenantId: payload.Tid,
+		ObjectId: payload.Oid,
+		Upn:      payload.Upn,
+	}
+}
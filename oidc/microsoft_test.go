@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMicrosoftIdTokenPayload_Validate(t *testing.T) {
+	const (
+		tenantA = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+		tenantB = "0f6fa2f0-2b2a-4b2d-9c57-3b1d5d4e0c11"
+		// personalTenant は個人のMicrosoftアカウントのid_tokenのtid
+		personalTenant = "9188040d-6c67-4c5b-b112-36a304b66dad"
+	)
+
+	patterns := []struct {
+		desc           string
+		expected       error
+		iss            string
+		tid            string
+		oid            string
+		issuer         string
+		allowedTenants []string
+	}{
+		{
+			"マルチテナントでissがtidと一致",
+			nil,
+			microsoftLoginHost + "/" + tenantA + "/v2.0",
+			tenantA,
+			"oid",
+			microsoftIssuerTemplate,
+			nil,
+		},
+		{
+			"個人アカウント",
+			nil,
+			microsoftLoginHost + "/" + personalTenant + "/v2.0",
+			personalTenant,
+			"oid",
+			microsoftIssuerTemplate,
+			nil,
+		},
+		{
+			"issのテナントがtidと一致しない",
+			errIssMismatch,
+			microsoftLoginHost + "/" + tenantB + "/v2.0",
+			tenantA,
+			"oid",
+			microsoftIssuerTemplate,
+			nil,
+		},
+		{
+			"tidがない",
+			errTidMissing,
+			microsoftLoginHost + "/" + tenantA + "/v2.0",
+			"",
+			"oid",
+			microsoftIssuerTemplate,
+			nil,
+		},
+		{
+			"許可したテナント",
+			nil,
+			microsoftLoginHost + "/" + tenantA + "/v2.0",
+			tenantA,
+			"oid",
+			microsoftIssuerTemplate,
+			[]string{tenantB, tenantA},
+		},
+		{
+			"許可していないテナント",
+			&TenantError{},
+			microsoftLoginHost + "/" + tenantA + "/v2.0",
+			tenantA,
+			"oid",
+			microsoftIssuerTemplate,
+			[]string{tenantB},
+		},
+		{
+			"oidがない",
+			errOidMissing,
+			microsoftLoginHost + "/" + tenantA + "/v2.0",
+			tenantA,
+			"",
+			microsoftIssuerTemplate,
+			nil,
+		},
+		{
+			"シングルテナントはissuerと完全一致",
+			nil,
+			microsoftLoginHost + "/" + tenantA + "/v2.0",
+			tenantA,
+			"oid",
+			microsoftLoginHost + "/" + tenantA + "/v2.0",
+			nil,
+		},
+		{
+			"シングルテナントで別のテナント",
+			errIssMismatch,
+			microsoftLoginHost + "/" + tenantB + "/v2.0",
+			tenantB,
+			"oid",
+			microsoftLoginHost + "/" + tenantA + "/v2.0",
+			nil,
+		},
+	}
+
+	for _, pattern := range patterns {
+		payload := microsoftIdTokenPayload{
+			StandardClaims: StandardClaims{
+				Iss: pattern.iss,
+				Aud: audience{"client-id"},
+				Exp: time.Now().Add(time.Hour).Unix(),
+				Iat: time.Now().Unix(),
+			},
+			Oid: pattern.oid,
+			Tid: pattern.tid,
+		}
+
+		err := payload.validate(ValidationParams{
+			Issuer:         pattern.issuer,
+			ClientId:       "client-id",
+			AllowedTenants: pattern.allowedTenants,
+		})
+		var tenantErr *TenantError
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+		} else if errors.As(pattern.expected, &tenantErr) {
+			assert.True(t, errors.As(err, &tenantErr), pattern.desc)
+			assert.Equal(t, pattern.tid, tenantErr.Tid, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+}
+
+func TestNewIdToken_Microsoft(t *testing.T) {
+	payload := `{
+  "sub": "AAAAAAAAAAAAAAAAAAAAAIkzqFVrSaSaFHy782bbtaQ",
+  "oid": "00000000-0000-0000-66f3-3332eca7ea81",
+  "tid": "9122040d-6c67-4c5b-b112-36a304b66dad",
+  "preferred_username": "jane@contoso.com",
+  "upn": "jane@contoso.com"
+}`
+	rawToken := b64([]byte(`{"alg": "RS256", "kid": "kid1"}`)) + "." + b64([]byte(payload)) + ".sig"
+
+	token, err := NewIdToken(rawToken, Microsoft)
+	assert.Nil(t, err)
+
+	msPayload := token.Payload.(*microsoftIdTokenPayload)
+	assert.Equal(t, "jane@contoso.com", msPayload.PreferredUsername)
+	assert.Equal(t, "jane@contoso.com", msPayload.Upn)
+	// subではなくtidとoidの組でユーザーを識別する
+	assert.Equal(
+		t,
+		"9122040d-6c67-4c5b-b112-36a304b66dad:00000000-0000-0000-66f3-3332eca7ea81",
+		token.Payload.(userKeyer).GetUserKey(),
+	)
+
+	var identity Identity
+	token.Payload.(identityExtender).extendIdentity(&identity)
+	assert.Equal(t, MicrosoftIdentity{
+		TenantId: "9122040d-6c67-4c5b-b112-36a304b66dad",
+		ObjectId: "00000000-0000-0000-66f3-3332eca7ea81",
+		Upn:      "jane@contoso.com",
+	}, identity.Microsoft)
+}
+
+func TestNewMicrosoftOidcClient(t *testing.T) {
+	client := newMicrosoftOidcClient("organizations", "client-id", "secret")
+	client.SetAllowedTenants([]string{" tenant-a ", "", "tenant-b"})
+
+	assert.Equal(t, Microsoft, client.IdProvider)
+	assert.Equal(t, microsoftLoginHost+"/organizations/oauth2/v2.0/authorize", client.authEndpoint)
+	assert.Equal(t, []string{"tenant-a", "tenant-b"}, client.ValidationParams().AllowedTenants)
+	assert.Equal(t, Microsoft, idProviderFromIssuer(microsoftLoginHost+"/tenant-a/v2.0"))
+}
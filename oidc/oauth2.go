@@ -0,0 +1,89 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// profileFetcher はアクセストークンを使ってIdPのAPIからユーザーの情報を取得する
+type profileFetcher func(ctx context.Context, accessToken string) (Identity, error)
+
+// oauth2Client はid_tokenを発行しない、OAuth2とプロフィールAPIでログインするIdPのクライアント
+//
+// 認可リクエストとトークンエンドポイントとのやりとりはOIDCと同じなのでoidcClientに任せ、
+// id_tokenの検証の代わりにfetchProfileでユーザーの情報を取得する
+type oauth2Client struct {
+	oauth        *oidcClient
+	fetchProfile profileFetcher
+}
+
+// AuthUrl は認可エンドポイントのURLを返す
+func (c oauth2Client) AuthUrl(
+	respType string,
+	scopes []string,
+	redirectUrl string,
+	state string,
+	opts ...AuthOption,
+) string {
+	return c.oauth.AuthUrl(respType, scopes, redirectUrl, state, opts...)
+}
+
+// Exchange は認可コードをトークンに交換し、プロフィールAPIからユーザーの情報を取得する
+//
+// id_tokenが無いのでnonceは検証できない。CSRFはstate、認可コードの横取りはPKCEで防ぐ。
+// トークンとプロフィールの取得はoidcClient.Exchangeと同じくhttpTimeoutSecで打ち切る
+func (c oauth2Client) Exchange(
+	ctx context.Context,
+	code string,
+	redirectUrl string,
+	codeVerifier string,
+	_ string,
+) (Identity, error) {
+	ctx, cancel := context.WithTimeout(ctx, httpTimeoutSec*time.Second)
+	defer cancel()
+
+	tokenResp, err := c.oauth.exchangeCode(ctx, code, redirectUrl, "authorization_code", codeVerifier)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	identity, err := c.fetchProfile(ctx, tokenResp.AccessToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	identity.IdProvider = c.oauth.IdProvider
+	identity.Token = tokenResp.Token()
+
+	return identity, nil
+}
+
+// getWithToken はアクセストークンを付けてGETし、レスポンスのボディを返す
+func getWithToken(ctx context.Context, endpoint string, accessToken string, accept string) ([]byte, error) {
+	reqWithCtx, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request of GET %s: %w", endpoint, err)
+	}
+	reqWithCtx.Header.Set("Authorization", "Bearer "+accessToken)
+	reqWithCtx.Header.Set("Accept", accept)
+
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(reqWithCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GET %s: %w", endpoint, err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status of GET %s: %d", endpoint, resp.StatusCode)
+	}
+	bRespBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxUserInfoSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of GET %s: %w", endpoint, err)
+	}
+
+	return bRespBody, nil
+}
@@ -0,0 +1,66 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// CodeChallengeMethodS256 はcode_challenge_methodとして送る値。plainは使わない
+const CodeChallengeMethodS256 = "S256"
+
+const (
+	// refs: https://www.rfc-editor.org/rfc/rfc7636#section-4.1
+	codeVerifierMinLength = 43
+	codeVerifierMaxLength = 128
+	// codeVerifierRandomBytes はcode_verifierの元になる乱数のバイト数。base64urlにすると64文字になる
+	codeVerifierRandomBytes = 48
+)
+
+var errInvalidCodeVerifier = errors.New("invalid code_verifier")
+
+// RandomCodeVerifier はPKCEで使うcode_verifierを生成する
+func RandomCodeVerifier() (string, error) {
+	b := make([]byte, codeVerifierRandomBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.New("unexpected error")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallengeS256 はcode_verifierからS256方式のcode_challengeを求める
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCodeChallenge はcode_verifierがcode_challengeと対応しているかを確認する
+func VerifyCodeChallenge(verifier string, challenge string) bool {
+	if validateCodeVerifier(verifier) != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(CodeChallengeS256(verifier)), []byte(challenge)) == 1
+}
+
+// validateCodeVerifier はcode_verifierが43文字以上128文字以下で、unreserved文字のみからなることを確認する
+func validateCodeVerifier(verifier string) error {
+	if len(verifier) < codeVerifierMinLength || len(verifier) > codeVerifierMaxLength {
+		return fmt.Errorf("%w: length %d", errInvalidCodeVerifier, len(verifier))
+	}
+
+	for _, c := range verifier {
+		isUnreserved := ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~'
+		if !isUnreserved {
+			return fmt.Errorf("%w: invalid character %q", errInvalidCodeVerifier, c)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomCodeVerifier(t *testing.T) {
+	verifier, err := RandomCodeVerifier()
+
+	assert.Nil(t, err)
+	assert.Nil(t, validateCodeVerifier(verifier))
+
+	other, _ := RandomCodeVerifier()
+	assert.NotEqual(t, verifier, other)
+}
+
+func TestCodeChallengeS256(t *testing.T) {
+	// refs: https://www.rfc-editor.org/rfc/rfc7636#appendix-B
+	actual := CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", actual)
+}
+
+func TestValidateCodeVerifier(t *testing.T) {
+	patterns := []struct {
+		desc          string
+		isExpectValid bool
+		verifier      string
+	}{
+		{"43文字", true, strings.Repeat("a", 43)},
+		{"128文字", true, strings.Repeat("a", 128)},
+		{"unreserved文字", true, "ABCxyz0189-._~" + strings.Repeat("a", 30)},
+		{"42文字", false, strings.Repeat("a", 42)},
+		{"129文字", false, strings.Repeat("a", 129)},
+		{"空白を含む", false, strings.Repeat("a", 42) + " "},
+		{"+を含む", false, strings.Repeat("a", 42) + "+"},
+		{"/を含む", false, strings.Repeat("a", 42) + "/"},
+		{"マルチバイト文字を含む", false, strings.Repeat("a", 42) + "あ"},
+	}
+
+	for _, pattern := range patterns {
+		err := validateCodeVerifier(pattern.verifier)
+		if pattern.isExpectValid {
+			assert.Nil(t, err, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, errInvalidCodeVerifier, pattern.desc)
+		}
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	verifier, _ := RandomCodeVerifier()
+	challenge := CodeChallengeS256(verifier)
+
+	assert.True(t, VerifyCodeChallenge(verifier, challenge))
+
+	other, _ := RandomCodeVerifier()
+	assert.False(t, VerifyCodeChallenge(other, challenge))
+	assert.False(t, VerifyCodeChallenge(challenge, challenge))
+}
@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// RFC 7009で定められたtoken_type_hint
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// RFC 7009 2.2.1と、Googleが失効済みのトークンに返すエラーコード
+const (
+	TokenErrorUnsupportedTokenType = "unsupported_token_type"
+	TokenErrorInvalidToken         = "invalid_token"
+)
+
+var errRevocationNotSupported = errors.New("revocation endpoint not configured")
+
+// Revoke はトークンをIdPに返却して失効させる
+//
+// tokenTypeHintはTokenTypeHintAccessTokenかTokenTypeHintRefreshToken。分からない場合は空文字でよい。
+// IdPがエラーを返した場合はTokenErrorを返す。
+// LINEのようにリフレッシュトークンを返却するAPIがないIdPでは、リフレッシュトークンは何もせずにnilを返す
+//
+// refs: https://www.rfc-editor.org/rfc/rfc7009
+func (c oidcClient) Revoke(ctx context.Context, token string, tokenTypeHint string) error {
+	if c.revocationEndpoint == "" {
+		return errRevocationNotSupported
+	}
+	if c.refreshTokenNotRevocable && tokenTypeHint == TokenTypeHintRefreshToken {
+		return nil
+	}
+
+	values := url.Values{}
+	if c.revocationTokenParam != "" {
+		// RFC 7009に従わないIdPはtoken_type_hintも受け付けない
+		values.Add(c.revocationTokenParam, token)
+	} else {
+		values.Add("token", token)
+		if tokenTypeHint != "" {
+			values.Add("token_type_hint", tokenTypeHint)
+		}
+	}
+
+	reqWithCtx, err := c.newClientAuthRequest(ctx, c.revocationEndpoint, values)
+	if err != nil {
+		return err
+	}
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(reqWithCtx)
+	if err != nil {
+		return fmt.Errorf("failed to POST revocation endpoint: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	bRespBody, err := readTokenResponseBody(resp)
+	if err != nil {
+		return err
+	}
+	tokenErr := &TokenError{}
+	if err := json.Unmarshal(bRespBody, tokenErr); err != nil {
+		return fmt.Errorf("%w: status %d: %v", errTokenResponseNotJson, resp.StatusCode, err)
+	}
+	tokenErr.StatusCode = resp.StatusCode
+
+	return tokenErr
+}
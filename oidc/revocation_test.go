@@ -0,0 +1,79 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOidcClient_Revoke(t *testing.T) {
+	client := NewGoogleOidcClient()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", "https://oauth2.googleapis.com/revoke",
+		func(req *http.Request) (*http.Response, error) {
+			if err := req.ParseForm(); err != nil {
+				return nil, err
+			}
+			switch req.PostForm.Get("token") {
+			case "DummyRefreshToken":
+				if req.PostForm.Get("token_type_hint") != TokenTypeHintRefreshToken {
+					return httpmock.NewStringResponse(400, `{"error": "invalid_request"}`), nil
+				}
+
+				return httpmock.NewStringResponse(200, ""), nil
+			case "ExpiredToken":
+				return httpmock.NewStringResponse(400, `{"error": "invalid_token", "error_description": "Token expired or revoked"}`), nil
+			default:
+				return httpmock.NewStringResponse(503, "Service Unavailable"), nil
+			}
+		},
+	)
+
+	assert.Nil(t, client.Revoke(context.Background(), "DummyRefreshToken", TokenTypeHintRefreshToken))
+
+	err := client.Revoke(context.Background(), "ExpiredToken", TokenTypeHintAccessToken)
+	var tokenErr *TokenError
+	assert.True(t, errors.As(err, &tokenErr))
+	assert.Equal(t, TokenErrorInvalidToken, tokenErr.Code)
+	assert.Equal(t, http.StatusBadRequest, tokenErr.StatusCode)
+
+	err = client.Revoke(context.Background(), "Other", "")
+	assert.ErrorIs(t, err, errTokenResponseNotJson)
+}
+
+func TestOidcClient_Revoke_NotSupported(t *testing.T) {
+	client := newOidcClient(Generic, "client-id", "", "", "", "")
+
+	assert.ErrorIs(t, client.Revoke(context.Background(), "token", ""), errRevocationNotSupported)
+}
+
+func TestOidcClient_Revoke_Line(t *testing.T) {
+	client := newLineOidcClient("1234567890", "channel-secret")
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", "https://api.line.me/oauth2/v2.1/revoke",
+		func(req *http.Request) (*http.Response, error) {
+			if err := req.ParseForm(); err != nil {
+				return nil, err
+			}
+			if req.PostForm.Get("access_token") != "DummyAccessToken" || req.PostForm.Get("token") != "" ||
+				req.PostForm.Get("client_id") != "1234567890" || req.PostForm.Get("client_secret") != "channel-secret" {
+				return httpmock.NewStringResponse(400, `{"error": "invalid_request"}`), nil
+			}
+
+			return httpmock.NewStringResponse(200, ""), nil
+		},
+	)
+
+	assert.Nil(t, client.Revoke(context.Background(), "DummyAccessToken", TokenTypeHintAccessToken))
+	// リフレッシュトークンは返却するAPIがないので送らない
+	assert.Nil(t, client.Revoke(context.Background(), "DummyRefreshToken", TokenTypeHintRefreshToken))
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
@@ -0,0 +1,149 @@
+package oidc
+
+// StandardClaims はOIDC Coreで定められたクレームをunmarshalするための構造体
+//
+// IdPごとのpayloadはこれを埋め込み、独自のクレームや検証を上乗せする。
+//
+// refs: https://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
+type StandardClaims struct {
+	Iss string `json:"iss"`
+	// クライアントID。文字列と配列のどちらでも送られうる
+	Aud audience `json:"aud"`
+	// Azp は認可を受けたクライアントのID。audが複数ある場合に必須
+	Azp string `json:"azp"`
+	// ID Provider内でのID。メアドではなくこちらがユーザー識別子となる
+	Sub      string   `json:"sub"`
+	Exp      int64    `json:"exp"`
+	Iat      int64    `json:"iat"`
+	Nbf      int64    `json:"nbf"`
+	AuthTime int64    `json:"auth_time"`
+	Acr      string   `json:"acr"`
+	Amr      []string `json:"amr"`
+	Nonce    string   `json:"nonce"`
+	AtHash   string   `json:"at_hash"`
+
+	Name                string   `json:"name"`
+	GivenName           string   `json:"given_name"`
+	FamilyName          string   `json:"family_name"`
+	MiddleName          string   `json:"middle_name"`
+	Nickname            string   `json:"nickname"`
+	PreferredUsername   string   `json:"preferred_username"`
+	Profile             string   `json:"profile"`
+	Picture             string   `json:"picture"`
+	Website             string   `json:"website"`
+	Email               string   `json:"email"`
+	EmailVerified       bool     `json:"email_verified"`
+	Gender              string   `json:"gender"`
+	Birthdate           string   `json:"birthdate"`
+	Zoneinfo            string   `json:"zoneinfo"`
+	Locale              string   `json:"locale"`
+	PhoneNumber         string   `json:"phone_number"`
+	PhoneNumberVerified bool     `json:"phone_number_verified"`
+	Address             *Address `json:"address"`
+	UpdatedAt           int64    `json:"updated_at"`
+
+	// Raw は標準クレーム以外も含めた全てのクレーム。カスタムクレームを取り出すのに使う
+	Raw map[string]interface{} `json:"-"`
+}
+
+// Address はaddressクレーム
+type Address struct {
+	Formatted     string `json:"formatted"`
+	StreetAddress string `json:"street_address"`
+	Locality      string `json:"locality"`
+	Region        string `json:"region"`
+	PostalCode    string `json:"postal_code"`
+	Country       string `json:"country"`
+}
+
+// validate はpayloadの中身を検証する。issuerはValidationParams.Issuerと完全に一致しなければならない
+func (claims StandardClaims) validate(params ValidationParams) error {
+	if err := claims.validateIss(params.Issuer); err != nil {
+		return err
+	}
+
+	return claims.validateClaims(params)
+}
+
+// validateClaims はIssuer以外の
+//
+// - Audience, Authorized Party
+//
+// - Expiration, Issued At, Not Before, Auth Time
+//
+// - Authentication Context Class Reference
+//
+// - Nonce
+//
+// を確認する。IdPごとのpayloadはIssuerの確認だけを差し替えてこれを呼ぶ
+func (claims StandardClaims) validateClaims(params ValidationParams) error {
+	if err := claims.validateAud(params.ClientId); err != nil {
+		return err
+	}
+
+	if err := claims.validateTimes(params); err != nil {
+		return err
+	}
+
+	if err := validateAcr(claims.Acr, params.AcrValues); err != nil {
+		return err
+	}
+
+	if err := claims.validateNonce(params.Nonce); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (claims StandardClaims) validateIss(issuer string) error {
+	if issuer == "" || claims.Iss != issuer {
+		return errIssMismatch
+	}
+
+	return nil
+}
+
+func (claims StandardClaims) validateAud(clientId string) error {
+	return validateAudience(claims.Aud, claims.Azp, clientId)
+}
+
+func (claims StandardClaims) validateTimes(params ValidationParams) error {
+	return validateTimeClaims(
+		timeClaims{exp: claims.Exp, iat: claims.Iat, nbf: claims.Nbf, authTime: claims.AuthTime},
+		params,
+	)
+}
+
+// validateNonce は認可リクエストで送ったnonceとid_tokenのnonceが一致するかを確認する
+func (claims StandardClaims) validateNonce(nonce string) error {
+	return validateNonce(claims.Nonce, nonce)
+}
+
+func (claims StandardClaims) GetSub() string {
+	return claims.Sub
+}
+
+// GetEmail はid_tokenからメールアドレスを取得する
+//
+// IdPによってはid_tokenにメールアドレスが入っていないので、UserInfo Endpointから取得する必要がある
+func (claims StandardClaims) GetEmail() (string, error) {
+	return claims.Email, nil
+}
+
+// GetClaims は標準クレームを返す
+func (claims StandardClaims) GetClaims() StandardClaims {
+	return claims
+}
+
+// standardClaims はunmarshal後にRawをセットするために、埋め込まれたStandardClaimsへのポインタを返す
+func (claims *StandardClaims) standardClaims() *StandardClaims {
+	return claims
+}
+
+// StringClaim はRawから文字列のカスタムクレームを取り出す
+func (claims StandardClaims) StringClaim(name string) (string, bool) {
+	v, ok := claims.Raw[name].(string)
+
+	return v, ok
+}
@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIdToken_StandardClaims(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg": "RS256", "kid": "kid1"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{
+  "iss": "https://idp.example.com",
+  "sub": "248289761001",
+  "aud": "client-id",
+  "name": "Jane Doe",
+  "given_name": "Jane",
+  "family_name": "Doe",
+  "picture": "https://idp.example.com/janedoe/me.jpg",
+  "locale": "ja-JP",
+  "email": "janedoe@example.com",
+  "email_verified": true,
+  "phone_number": "+81 90-0000-0000",
+  "address": {"country": "JP", "postal_code": "100-0001"},
+  "updated_at": 1311280970,
+  "groups": "admin"
+}`))
+	rawToken := strings.Join([]string{header, payload, "sig"}, ".")
+
+	for _, provider := range []IdProvider{Generic, Google} {
+		token, err := NewIdToken(rawToken, provider)
+		assert.Nil(t, err)
+
+		claims := token.Payload.GetClaims()
+		assert.Equal(t, "248289761001", token.Payload.GetSub())
+		assert.Equal(t, "Jane Doe", claims.Name)
+		assert.Equal(t, "Jane", claims.GivenName)
+		assert.Equal(t, "Doe", claims.FamilyName)
+		assert.Equal(t, "ja-JP", claims.Locale)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, "+81 90-0000-0000", claims.PhoneNumber)
+		assert.Equal(t, "JP", claims.Address.Country)
+		assert.Equal(t, int64(1311280970), claims.UpdatedAt)
+
+		// カスタムクレームはRawから取り出せる
+		groups, ok := claims.StringClaim("groups")
+		assert.True(t, ok)
+		assert.Equal(t, "admin", groups)
+	}
+}
+
+func TestStandardClaims_Validate(t *testing.T) {
+	const issuer = "https://idp.example.com"
+
+	patterns := []struct {
+		desc     string
+		expected error
+		iss      string
+		issuer   string
+	}{
+		{"issuerが一致", nil, issuer, issuer},
+		{"issuerが一致しない", errIssMismatch, "https://evil.example.com", issuer},
+		{"末尾のスラッシュも区別する", errIssMismatch, issuer + "/", issuer},
+		{"期待するissuerが設定されていない", errIssMismatch, issuer, ""},
+	}
+
+	for _, pattern := range patterns {
+		claims := StandardClaims{
+			Iss: pattern.iss,
+			Aud: audience{"client-id"},
+			Exp: time.Now().Add(time.Hour).Unix(),
+			Iat: time.Now().Unix(),
+		}
+
+		err := claims.validate(ValidationParams{Issuer: pattern.issuer, ClientId: "client-id"})
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxTokenResponseSize はトークンエンドポイントのレスポンスとして読み込む最大バイト数
+const maxTokenResponseSize = 1 << 20
+
+// RFC 6749 5.2で定められたエラーコード
+const (
+	TokenErrorInvalidRequest       = "invalid_request"
+	TokenErrorInvalidClient        = "invalid_client"
+	TokenErrorInvalidGrant         = "invalid_grant"
+	TokenErrorUnauthorizedClient   = "unauthorized_client"
+	TokenErrorUnsupportedGrantType = "unsupported_grant_type"
+	TokenErrorInvalidScope         = "invalid_scope"
+)
+
+var (
+	errTokenResponseTooLarge      = errors.New("token response too large")
+	errTokenResponseNotJson       = errors.New("token response is not JSON")
+	errTokenResponseNoAccessToken = errors.New("token response has no access_token")
+)
+
+// TokenError はトークンエンドポイントが返したエラーレスポンス
+//
+// refs: https://www.rfc-editor.org/rfc/rfc6749#section-5.2
+type TokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+	StatusCode  int    `json:"-"`
+}
+
+func (e *TokenError) Error() string {
+	msg := fmt.Sprintf("token endpoint error: %s (status %d)", e.Code, e.StatusCode)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+
+	return msg
+}
+
+// readTokenResponseBody はレスポンスボディを読み込む。大きすぎるボディは読み切らずにエラーにする
+func readTokenResponseBody(resp *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if len(body) > maxTokenResponseSize {
+		return nil, fmt.Errorf("%w: status %d", errTokenResponseTooLarge, resp.StatusCode)
+	}
+
+	return body, nil
+}
+
+// parseTokenResponse はステータスコードとボディからトークンまたはTokenErrorを返す
+//
+// 200でもerrorを含むレスポンスを返すIdPがあるので、ボディにerrorがあればTokenErrorとして扱う
+func parseTokenResponse(statusCode int, body []byte) (tokenResponse, error) {
+	tokenErr := &TokenError{}
+	if err := json.Unmarshal(body, tokenErr); err != nil {
+		return tokenResponse{}, fmt.Errorf("%w: status %d: %v", errTokenResponseNotJson, statusCode, err)
+	}
+	if tokenErr.Code != "" || statusCode != http.StatusOK {
+		tokenErr.StatusCode = statusCode
+
+		return tokenResponse{}, tokenErr
+	}
+
+	tokenResp := &tokenResponse{}
+	if err := json.Unmarshal(body, tokenResp); err != nil {
+		return tokenResponse{}, fmt.Errorf("failed to unmarshal token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return tokenResponse{}, errTokenResponseNoAccessToken
+	}
+
+	return *tokenResp, nil
+}
@@ -0,0 +1,85 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOidcClient_PostTokenEndpoint_Errors(t *testing.T) {
+	client := NewGoogleOidcClient()
+
+	patterns := []struct {
+		desc          string
+		status        int
+		body          string
+		expectedErr   error
+		expectedToken *TokenError
+	}{
+		{
+			"invalid_grant",
+			http.StatusBadRequest,
+			`{"error": "invalid_grant", "error_description": "Bad Request"}`,
+			nil,
+			&TokenError{Code: TokenErrorInvalidGrant, Description: "Bad Request", StatusCode: http.StatusBadRequest},
+		},
+		{
+			"invalid_client",
+			http.StatusUnauthorized,
+			`{"error": "invalid_client", "error_uri": "https://example.com/errors/invalid_client"}`,
+			nil,
+			&TokenError{
+				Code:       TokenErrorInvalidClient,
+				URI:        "https://example.com/errors/invalid_client",
+				StatusCode: http.StatusUnauthorized,
+			},
+		},
+		{
+			"200でもerrorを含む",
+			http.StatusOK,
+			`{"error": "invalid_grant"}`,
+			nil,
+			&TokenError{Code: TokenErrorInvalidGrant, StatusCode: http.StatusOK},
+		},
+		{
+			"JSONではない",
+			http.StatusBadGateway,
+			`<html>Bad Gateway</html>`,
+			errTokenResponseNotJson,
+			nil,
+		},
+		{
+			"大きすぎる",
+			http.StatusOK,
+			`{"access_token": "` + strings.Repeat("a", maxTokenResponseSize) + `"}`,
+			errTokenResponseTooLarge,
+			nil,
+		},
+		{
+			"access_tokenがない",
+			http.StatusOK,
+			`{}`,
+			errTokenResponseNoAccessToken,
+			nil,
+		},
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for _, pattern := range patterns {
+		httpmock.RegisterResponder("POST", client.tokenEndpoint, httpmock.NewStringResponder(pattern.status, pattern.body))
+
+		_, err := client.PostTokenEndpoint("", "", "authorization_code", "")
+		if pattern.expectedToken != nil {
+			var tokenErr *TokenError
+			assert.True(t, errors.As(err, &tokenErr), pattern.desc)
+			assert.Equal(t, pattern.expectedToken, tokenErr, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expectedErr, pattern.desc)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// tokenExpiryDelta は有効期限のこの時間前からアクセストークンを期限切れとみなしてリフレッシュする
+const tokenExpiryDelta = 1 * time.Minute
+
+var errNoRefreshToken = errors.New("access token expired and no refresh token")
+
+// Token はアクセストークンとリフレッシュトークン、アクセストークンの有効期限の組
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	// Expiry はアクセストークンの有効期限。ゼロ値の場合は期限がないものとして扱う
+	Expiry time.Time
+}
+
+// Token はトークンエンドポイントのレスポンスをexpires_inから有効期限を求めたTokenに変換する
+func (resp tokenResponse) Token() Token {
+	return resp.tokenAt(time.Now())
+}
+
+func (resp tokenResponse) tokenAt(now time.Time) Token {
+	token := Token{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		TokenType:    resp.TokenType,
+	}
+	if resp.ExpiresIn > 0 {
+		token.Expiry = now.Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+
+	return token
+}
+
+func (t Token) valid(now time.Time) bool {
+	if t.AccessToken == "" {
+		return false
+	}
+
+	return t.Expiry.IsZero() || now.Add(tokenExpiryDelta).Before(t.Expiry)
+}
+
+// refresher はリフレッシュトークンから新しいトークンを得る。oidcClientが実装する
+type refresher interface {
+	Refresh(ctx context.Context, refreshToken string) (tokenResponse, error)
+}
+
+// TokenSource は期限切れが近いアクセストークンを自動でリフレッシュしながら返す
+//
+// バックエンドのジョブからユーザーの代わりにIdPのAPIを呼ぶ場合に使う。複数のgoroutineから呼んでよい
+type TokenSource struct {
+	mu        sync.Mutex
+	refresher refresher
+	token     Token
+	now       func() time.Time
+	// onRefresh はリフレッシュした後に呼ばれる。新しいトークンを保存するのに使う
+	onRefresh func(Token)
+}
+
+// TokenSource は保存していたトークンからTokenSourceを返す
+//
+// onRefreshはリフレッシュするたびに新しいトークンを渡して呼ばれる。不要な場合はnil
+func (c oidcClient) TokenSource(token Token, onRefresh func(Token)) *TokenSource {
+	return &TokenSource{
+		refresher: c,
+		token:     token,
+		now:       time.Now,
+		onRefresh: onRefresh,
+	}
+}
+
+// Token は有効なアクセストークンを返す。期限切れが近い場合はリフレッシュしてから返す
+func (s *TokenSource) Token(ctx context.Context) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.valid(s.now()) {
+		return s.token, nil
+	}
+	if s.token.RefreshToken == "" {
+		return Token{}, errNoRefreshToken
+	}
+
+	resp, err := s.refresher.Refresh(ctx, s.token.RefreshToken)
+	if err != nil {
+		return Token{}, err
+	}
+	newToken := resp.tokenAt(s.now())
+	// リフレッシュトークンが返されなかった場合は今までのものを使い続ける
+	if newToken.RefreshToken == "" {
+		newToken.RefreshToken = s.token.RefreshToken
+	}
+	s.token = newToken
+
+	if s.onRefresh != nil {
+		s.onRefresh(newToken)
+	}
+
+	return newToken, nil
+}
@@ -0,0 +1,102 @@
+package oidc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRefresher struct {
+	calls int
+	resp  tokenResponse
+	err   error
+}
+
+func (r *fakeRefresher) Refresh(_ context.Context, _ string) (tokenResponse, error) {
+	r.calls++
+
+	return r.resp, r.err
+}
+
+func newTestTokenSource(r refresher, token Token, now *time.Time) *TokenSource {
+	return &TokenSource{refresher: r, token: token, now: func() time.Time { return *now }}
+}
+
+func TestTokenSource_Token(t *testing.T) {
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := &fakeRefresher{resp: tokenResponse{AccessToken: "new-access", ExpiresIn: 3600}}
+	var refreshed []Token
+	s := newTestTokenSource(r, Token{
+		AccessToken:  "old-access",
+		RefreshToken: "refresh",
+		Expiry:       now.Add(10 * time.Minute),
+	}, &now)
+	s.onRefresh = func(token Token) {
+		refreshed = append(refreshed, token)
+	}
+
+	// 有効期限内はリフレッシュしない
+	token, err := s.Token(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "old-access", token.AccessToken)
+	assert.Equal(t, 0, r.calls)
+
+	// 期限切れ間近になったらリフレッシュし、返されなかったリフレッシュトークンは引き継ぐ
+	now = now.Add(9*time.Minute + 30*time.Second)
+	token, err = s.Token(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "new-access", token.AccessToken)
+	assert.Equal(t, "refresh", token.RefreshToken)
+	assert.Equal(t, now.Add(time.Hour), token.Expiry)
+	assert.Equal(t, 1, r.calls)
+	assert.Equal(t, []Token{token}, refreshed)
+
+	// リフレッシュ後のトークンは使い回す
+	_, _ = s.Token(context.Background())
+	assert.Equal(t, 1, r.calls)
+}
+
+func TestTokenSource_Token_RotatesRefreshToken(t *testing.T) {
+	now := time.Now()
+	r := &fakeRefresher{resp: tokenResponse{AccessToken: "new-access", RefreshToken: "new-refresh", ExpiresIn: 3600}}
+	s := newTestTokenSource(r, Token{AccessToken: "old-access", RefreshToken: "old-refresh", Expiry: now}, &now)
+
+	token, err := s.Token(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "new-refresh", token.RefreshToken)
+}
+
+func TestTokenSource_Token_Errors(t *testing.T) {
+	now := time.Now()
+
+	s := newTestTokenSource(&fakeRefresher{}, Token{AccessToken: "old-access", Expiry: now}, &now)
+	_, err := s.Token(context.Background())
+	assert.ErrorIs(t, err, errNoRefreshToken)
+
+	tokenErr := &TokenError{Code: TokenErrorInvalidGrant}
+	s = newTestTokenSource(&fakeRefresher{err: tokenErr}, Token{RefreshToken: "revoked"}, &now)
+	_, err = s.Token(context.Background())
+	assert.ErrorIs(t, err, tokenErr)
+}
+
+func TestTokenSource_Token_Concurrent(t *testing.T) {
+	now := time.Now()
+	r := &fakeRefresher{resp: tokenResponse{AccessToken: "new-access", ExpiresIn: 3600}}
+	s := newTestTokenSource(r, Token{RefreshToken: "refresh"}, &now)
+
+	const goroutines = 10
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			_, _ = s.Token(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, r.calls)
+}
@@ -0,0 +1,181 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxUserInfoSize はUserInfoレスポンスとして読み込む最大バイト数
+const maxUserInfoSize = 1 << 20
+
+var (
+	errUserInfoNotSupported = errors.New("userinfo endpoint not configured")
+	errUserInfoSubMissing   = errors.New("userinfo sub missing")
+	errUserInfoSubMismatch  = errors.New("userinfo sub does not match id_token sub")
+	errUserInfoIssMismatch  = errors.New("signed userinfo issuer mismatch")
+	errUserInfoAudMismatch  = errors.New("signed userinfo audience mismatch")
+)
+
+// UserInfo はアクセストークンを使ってUserInfoエンドポイントからクレームを取得する
+//
+// レスポンスはJSON(application/json)と署名付きJWT(application/jwt)のどちらにも対応する。
+// id_tokenのsubとの突き合わせはStandardClaims.MergeUserInfoで行う
+func (c oidcClient) UserInfo(ctx context.Context, accessToken string) (StandardClaims, error) {
+	if c.userinfoEndpoint == "" {
+		return StandardClaims{}, errUserInfoNotSupported
+	}
+
+	reqWithCtx, err := http.NewRequestWithContext(ctx, http.MethodGet, c.userinfoEndpoint, nil)
+	if err != nil {
+		return StandardClaims{}, fmt.Errorf("failed to create request of GET userinfo endpoint: %w", err)
+	}
+	reqWithCtx.Header.Set("Authorization", "Bearer "+accessToken)
+	reqWithCtx.Header.Set("Accept", "application/json, application/jwt")
+
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(reqWithCtx)
+	if err != nil {
+		return StandardClaims{}, fmt.Errorf("failed to GET userinfo endpoint: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return StandardClaims{}, fmt.Errorf(
+			"unexpected status of userinfo endpoint: %d %s",
+			resp.StatusCode,
+			resp.Header.Get("WWW-Authenticate"),
+		)
+	}
+	bRespBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxUserInfoSize))
+	if err != nil {
+		return StandardClaims{}, fmt.Errorf("failed to read userinfo response: %w", err)
+	}
+
+	var claims StandardClaims
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/jwt" {
+		claims, err = c.parseSignedUserInfo(strings.TrimSpace(string(bRespBody)))
+	} else {
+		claims, err = parseUserInfo(bRespBody)
+	}
+	if err != nil {
+		return StandardClaims{}, err
+	}
+
+	if claims.Sub == "" {
+		return StandardClaims{}, errUserInfoSubMissing
+	}
+
+	return claims, nil
+}
+
+func parseUserInfo(body []byte) (StandardClaims, error) {
+	claims := StandardClaims{}
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return StandardClaims{}, fmt.Errorf("failed to unmarshal userinfo response: %w", err)
+	}
+	if err := json.Unmarshal(body, &claims.Raw); err != nil {
+		return StandardClaims{}, fmt.Errorf("failed to unmarshal userinfo response: %w", err)
+	}
+
+	return claims, nil
+}
+
+// parseSignedUserInfo は署名付きJWTのUserInfoレスポンスを、id_tokenと同じ鍵で検証してからクレームを取り出す
+//
+// iss, audは含まれている場合のみ確認する
+func (c oidcClient) parseSignedUserInfo(rawToken string) (StandardClaims, error) {
+	token, err := NewIdToken(rawToken, c.IdProvider)
+	if err != nil {
+		return StandardClaims{}, err
+	}
+	if err := token.validateSignature(c.JwksEndpoint, c.allowedAlgs); err != nil {
+		return StandardClaims{}, err
+	}
+
+	claims := token.Payload.GetClaims()
+	if claims.Iss != "" && claims.Iss != c.Issuer {
+		return StandardClaims{}, errUserInfoIssMismatch
+	}
+	if len(claims.Aud) > 0 && !claims.Aud.contains(c.ClientId) {
+		return StandardClaims{}, errUserInfoAudMismatch
+	}
+
+	return claims, nil
+}
+
+// MergeUserInfo はUserInfoのクレームをid_tokenのクレームに統合したものを返す
+//
+// UserInfoのsubがid_tokenのsubと一致しない場合は、別人のレスポンスである可能性があるのでエラーにする。
+// プロフィールのクレームはUserInfoの値を優先し、iss, aud, expなどid_token自体のクレームはそのまま残す
+//
+// refs: https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
+func (claims StandardClaims) MergeUserInfo(userInfo StandardClaims) (StandardClaims, error) {
+	if userInfo.Sub != claims.Sub {
+		return StandardClaims{}, errUserInfoSubMismatch
+	}
+
+	merged := claims
+	mergeString(&merged.Name, userInfo.Name)
+	mergeString(&merged.GivenName, userInfo.GivenName)
+	mergeString(&merged.FamilyName, userInfo.FamilyName)
+	mergeString(&merged.MiddleName, userInfo.MiddleName)
+	mergeString(&merged.Nickname, userInfo.Nickname)
+	mergeString(&merged.PreferredUsername, userInfo.PreferredUsername)
+	mergeString(&merged.Profile, userInfo.Profile)
+	mergeString(&merged.Picture, userInfo.Picture)
+	mergeString(&merged.Website, userInfo.Website)
+	mergeString(&merged.Gender, userInfo.Gender)
+	mergeString(&merged.Birthdate, userInfo.Birthdate)
+	mergeString(&merged.Zoneinfo, userInfo.Zoneinfo)
+	mergeString(&merged.Locale, userInfo.Locale)
+	if userInfo.Email != "" {
+		merged.Email = userInfo.Email
+		merged.EmailVerified = userInfo.EmailVerified
+	}
+	if userInfo.PhoneNumber != "" {
+		merged.PhoneNumber = userInfo.PhoneNumber
+		merged.PhoneNumberVerified = userInfo.PhoneNumberVerified
+	}
+	if userInfo.Address != nil {
+		merged.Address = userInfo.Address
+	}
+	if userInfo.UpdatedAt != 0 {
+		merged.UpdatedAt = userInfo.UpdatedAt
+	}
+
+	merged.Raw = map[string]interface{}{}
+	for k, v := range userInfo.Raw {
+		merged.Raw[k] = v
+	}
+	// id_token自体のクレームはUserInfoで上書きしない
+	for k, v := range claims.Raw {
+		if _, ok := merged.Raw[k]; !ok || isIdTokenClaim(k) {
+			merged.Raw[k] = v
+		}
+	}
+
+	return merged, nil
+}
+
+func mergeString(dst *string, src string) {
+	if src != "" {
+		*dst = src
+	}
+}
+
+func isIdTokenClaim(name string) bool {
+	switch name {
+	case "iss", "sub", "aud", "azp", "exp", "iat", "nbf", "auth_time", "acr", "amr", "nonce", "at_hash":
+		return true
+	default:
+		return false
+	}
+}
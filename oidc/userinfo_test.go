@@ -0,0 +1,133 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newUserInfoServer(t *testing.T, contentType string, body string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer DummyAccessToken" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestOidcClient_UserInfo_Json(t *testing.T) {
+	server := newUserInfoServer(t, "application/json; charset=utf-8", `{
+  "sub": "248289761001",
+  "name": "Jane Doe",
+  "email": "janedoe@example.com",
+  "email_verified": true,
+  "groups": "admin"
+}`)
+	defer server.Close()
+	client := newOidcClient(Generic, "client-id", "", "", "", "")
+	client.userinfoEndpoint = server.URL
+
+	claims, err := client.UserInfo(context.Background(), "DummyAccessToken")
+	assert.Nil(t, err)
+	assert.Equal(t, "248289761001", claims.Sub)
+	assert.Equal(t, "janedoe@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "admin", claims.Raw["groups"])
+
+	_, err = client.UserInfo(context.Background(), "InvalidAccessToken")
+	assert.Error(t, err)
+}
+
+func TestOidcClient_UserInfo_SignedJwt(t *testing.T) {
+	signer := newTestRsaSigner(t, "RS256", "userinfo", false, crypto.SHA256)
+	jwksServer := newTestJwksServer(t, signer.jwk)
+	defer jwksServer.Close()
+
+	patterns := []struct {
+		desc          string
+		isExpectValid bool
+		payload       string
+	}{
+		{"valid", true, `{"iss": "https://idp.example.com", "aud": "client-id", "sub": "248289761001", "email": "janedoe@example.com"}`},
+		{"iss, audなし", true, `{"sub": "248289761001", "email": "janedoe@example.com"}`},
+		{"issが一致しない", false, `{"iss": "https://evil.example.com", "sub": "248289761001"}`},
+		{"audが一致しない", false, `{"aud": "other", "sub": "248289761001"}`},
+		{"subがない", false, `{"email": "janedoe@example.com"}`},
+	}
+
+	for _, pattern := range patterns {
+		token := signedTestToken(t, signer, "RS256", pattern.payload)
+		server := newUserInfoServer(t, "application/jwt", token.rawToken)
+		client := newOidcClient(Generic, "client-id", "", "", "", jwksServer.URL)
+		client.Issuer = "https://idp.example.com"
+		client.userinfoEndpoint = server.URL
+
+		claims, err := client.UserInfo(context.Background(), "DummyAccessToken")
+		if pattern.isExpectValid {
+			assert.Nil(t, err, pattern.desc)
+			assert.Equal(t, "janedoe@example.com", claims.Email, pattern.desc)
+		} else {
+			assert.Error(t, err, pattern.desc)
+		}
+
+		server.Close()
+	}
+
+	// 署名が改竄されている場合は拒否する
+	token := signedTestToken(t, signer, "RS256", `{"sub": "248289761001"}`)
+	server := newUserInfoServer(t, "application/jwt", token.rawHeader+"."+b64([]byte(`{"sub": "1"}`))+"."+token.rawSignature)
+	defer server.Close()
+	client := newOidcClient(Generic, "client-id", "", "", "", jwksServer.URL)
+	client.userinfoEndpoint = server.URL
+	_, err := client.UserInfo(context.Background(), "DummyAccessToken")
+	assert.Error(t, err)
+}
+
+func TestOidcClient_UserInfo_NotSupported(t *testing.T) {
+	client := newOidcClient(Generic, "client-id", "", "", "", "")
+
+	_, err := client.UserInfo(context.Background(), "DummyAccessToken")
+	assert.ErrorIs(t, err, errUserInfoNotSupported)
+}
+
+func TestStandardClaims_MergeUserInfo(t *testing.T) {
+	idTokenClaims := StandardClaims{
+		Iss:  "https://idp.example.com",
+		Sub:  "248289761001",
+		Name: "Jane",
+		Raw:  map[string]interface{}{"iss": "https://idp.example.com", "sub": "248289761001", "name": "Jane"},
+	}
+
+	merged, err := idTokenClaims.MergeUserInfo(StandardClaims{
+		Sub:           "248289761001",
+		Name:          "Jane Doe",
+		Email:         "janedoe@example.com",
+		EmailVerified: true,
+		Raw: map[string]interface{}{
+			"iss":   "https://evil.example.com",
+			"sub":   "248289761001",
+			"name":  "Jane Doe",
+			"email": "janedoe@example.com",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://idp.example.com", merged.Iss)
+	assert.Equal(t, "Jane Doe", merged.Name)
+	assert.Equal(t, "janedoe@example.com", merged.Email)
+	assert.True(t, merged.EmailVerified)
+	assert.Equal(t, "https://idp.example.com", merged.Raw["iss"])
+	assert.Equal(t, "Jane Doe", merged.Raw["name"])
+
+	_, err = idTokenClaims.MergeUserInfo(StandardClaims{Sub: "other", Email: "attacker@example.com"})
+	assert.ErrorIs(t, err, errUserInfoSubMismatch)
+}
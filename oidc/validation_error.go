@@ -0,0 +1,29 @@
+package oidc
+
+import "errors"
+
+// ValidationError はIdPから受け取ったid_tokenやクレームを検証して拒否したことを表すエラー
+//
+// 通信の失敗とは違い、IdPが同じ応答を返す限りやり直しても解決しない
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return "failed to validate identity: " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// validationError はid_tokenの検証で拒否したエラーをValidationErrorにする
+//
+// JWKsを取得できなかった場合は通信の失敗なのでそのまま返す
+func validationError(err error) error {
+	if errors.Is(err, errJwksUnavailable) {
+		return err
+	}
+
+	return &ValidationError{Err: err}
+}
@@ -0,0 +1,42 @@
+package oidc
+
+import "os"
+
+// refs: https://developer.yahoo.co.jp/yconnect/v2/id_token.html
+const yahooJapanIssuer = "https://auth.login.yahoo.co.jp/yconnect/v2"
+
+// NewYahooJapanOidcClient はYahoo! JAPAN IDのYConnect v2のクライアントを返す
+//
+// id_tokenにはメールアドレスが含まれないので、emailスコープを要求してUserInfoから取得する
+func NewYahooJapanOidcClient() *oidcClient {
+	return newYahooJapanOidcClient(
+		os.Getenv("YAHOO_JAPAN_CLIENT_ID"),
+		clientSecret(os.Getenv("YAHOO_JAPAN_CLIENT_SECRET")),
+	)
+}
+
+func newYahooJapanOidcClient(clientId string, secret clientSecret) *oidcClient {
+	client := newOidcClient(
+		YahooJapan,
+		clientId,
+		secret,
+		yahooJapanIssuer+"/authorization",
+		yahooJapanIssuer+"/token",
+		yahooJapanIssuer+"/jwks",
+	)
+	client.Issuer = yahooJapanIssuer
+	client.userinfoEndpoint = "https://userinfo.yahooapis.jp/yconnect/v2/attribute"
+	// refs: https://auth.login.yahoo.co.jp/yconnect/v2/.well-known/openid-configuration
+	client.allowedAlgs = []string{"RS256"}
+	// Yahoo! JAPANはclient_secret_basicを推奨している
+	client.clientAuth = clientSecretBasicAuth{clientId: clientId, clientSecret: secret}
+
+	return client
+}
+
+// yahooJapanIdTokenPayload はYahoo! JAPANのid_tokenのpayloadをunmarshalするための構造体
+//
+// issは末尾のスラッシュなしのyahooJapanIssuerと完全に一致しなければならない
+type yahooJapanIdTokenPayload struct {
+	StandardClaims
+}
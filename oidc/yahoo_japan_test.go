@@ -0,0 +1,42 @@
+package oidc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYahooJapanIdTokenPayload_Validate(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		expected error
+		iss      string
+	}{
+		{"issuerが一致", nil, yahooJapanIssuer},
+		{"末尾にスラッシュ", errIssMismatch, yahooJapanIssuer + "/"},
+		{"v1のissuer", errIssMismatch, "https://auth.login.yahoo.co.jp"},
+	}
+
+	client := newYahooJapanOidcClient("client-id", "client-secret")
+	for _, pattern := range patterns {
+		payload := yahooJapanIdTokenPayload{StandardClaims{
+			Iss: pattern.iss,
+			Aud: audience{"client-id"},
+			Exp: time.Now().Add(time.Hour).Unix(),
+			Iat: time.Now().Unix(),
+		}}
+
+		err := payload.validate(client.ValidationParams())
+		if pattern.expected == nil {
+			assert.Nil(t, err, pattern.desc)
+		} else {
+			assert.ErrorIs(t, err, pattern.expected, pattern.desc)
+		}
+	}
+
+	// UserInfoからメールアドレスを補い、client_secret_basicで認証する
+	assert.NotEmpty(t, client.userinfoEndpoint)
+	assert.IsType(t, clientSecretBasicAuth{}, client.authenticator())
+	assert.Equal(t, YahooJapan, idProviderFromIssuer(yahooJapanIssuer))
+}
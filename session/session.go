@@ -0,0 +1,198 @@
+// Package session はログイン後のユーザーのセッションを管理します
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sns-login/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// CookieName はセッションIDを保存するcookieの名前
+	CookieName = "session_id"
+	// idBytes はセッションIDに使う乱数のバイト数
+	idBytes = 32
+	// DefaultIdleTimeout はアクセスがないままセッションを維持する期間
+	DefaultIdleTimeout = 30 * time.Minute
+	// DefaultAbsoluteTimeout はアクセスがあってもセッションを維持する最大の期間
+	DefaultAbsoluteTimeout = 24 * time.Hour
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+)
+
+// Store はセッションをDBに保存し、cookieのセッションIDと対応づける
+type Store struct {
+	db              *gorm.DB
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+	// now は現在時刻を返す。テストで差し替える
+	now func() time.Time
+}
+
+func NewStore(db *gorm.DB) *Store {
+	return &Store{
+		db:              db,
+		IdleTimeout:     DefaultIdleTimeout,
+		AbsoluteTimeout: DefaultAbsoluteTimeout,
+		now:             time.Now,
+	}
+}
+
+// Create はユーザーの新しいセッションを作成し、セッションIDをcookieに保存する
+//
+// セッション固定攻撃を防ぐため、ログイン前のセッションがあれば削除してから新しいセッションIDを発行する。
+// Getされないまま期限が切れたセッションもここでまとめて削除する
+func (s *Store) Create(w http.ResponseWriter, r *http.Request, userId uint) (model.Session, error) {
+	if err := s.deleteExpired(); err != nil {
+		return model.Session{}, err
+	}
+	if cookie, err := r.Cookie(CookieName); err == nil {
+		if err := s.deleteById(cookie.Value); err != nil {
+			return model.Session{}, err
+		}
+	}
+
+	id, err := newSessionId()
+	if err != nil {
+		return model.Session{}, err
+	}
+	now := s.now()
+	session := model.Session{
+		IdHash:     hashSessionId(id),
+		UserId:     userId,
+		ExpiresAt:  now.Add(s.AbsoluteTimeout),
+		LastSeenAt: now,
+		IpAddress:  remoteIp(r),
+		UserAgent:  r.UserAgent(),
+	}
+	if err := s.db.Create(&session).Error; err != nil {
+		return model.Session{}, fmt.Errorf("failed to create session: %w", err)
+	}
+	http.SetCookie(w, s.cookie(id, int(s.AbsoluteTimeout.Seconds())))
+
+	return session, nil
+}
+
+// Get はcookieのセッションIDに対応する有効なセッションを返し、最後にアクセスした時刻を更新する
+//
+// 期限切れのセッションは削除してErrSessionExpiredを返す
+func (s *Store) Get(r *http.Request) (model.Session, error) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return model.Session{}, ErrSessionNotFound
+	}
+
+	var session model.Session
+	err = s.db.Where("id_hash = ?", hashSessionId(cookie.Value)).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return model.Session{}, fmt.Errorf("failed to find session: %w", err)
+	}
+
+	now := s.now()
+	if now.After(session.ExpiresAt) || now.After(session.LastSeenAt.Add(s.IdleTimeout)) {
+		if err := s.db.Unscoped().Delete(&session).Error; err != nil {
+			return model.Session{}, fmt.Errorf("failed to delete session: %w", err)
+		}
+
+		return model.Session{}, ErrSessionExpired
+	}
+
+	if err := s.db.Model(&session).Update("last_seen_at", now).Error; err != nil {
+		return model.Session{}, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	return session, nil
+}
+
+// Destroy はcookieのセッションIDに対応するセッションを削除し、cookieも削除する
+func (s *Store) Destroy(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, s.cookie("", -1))
+
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil
+	}
+
+	return s.deleteById(cookie.Value)
+}
+
+// deleteExpired は最大の期間を過ぎたセッションと、アクセスがない期間が長いセッションを削除する
+func (s *Store) deleteExpired() error {
+	now := s.now()
+	err := s.db.Unscoped().
+		Where("expires_at < ? OR last_seen_at < ?", now, now.Add(-s.IdleTimeout)).
+		Delete(&model.Session{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) deleteById(id string) error {
+	// 論理削除ではなく物理削除して、ハッシュ値も残さない
+	if err := s.db.Unscoped().Where("id_hash = ?", hashSessionId(id)).Delete(&model.Session{}).Error; err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return nil
+}
+
+// cookie はセッションIDを保存するcookieを返す。maxAgeが負の場合はcookieを削除する
+func (s *Store) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:   CookieName,
+		Value:  value,
+		Path:   "/",
+		MaxAge: maxAge,
+		// ブラウザはlocalhostならhttpでもSecureなcookieを送るので、開発環境でも常にSecureにする
+		Secure:   true,
+		HttpOnly: true,
+		// IdPからリダイレクトで戻ってきた直後のGETでも送られるようにLaxにする
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// newSessionId は推測できないセッションIDを返す
+func newSessionId() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSessionId はDBに保存するセッションIDのハッシュ値を返す
+//
+// セッションIDは十分に長い乱数なので、ソルトやストレッチングは不要
+func hashSessionId(id string) string {
+	sum := sha256.Sum256([]byte(id))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// remoteIp は接続元のIPアドレスを返す。X-Forwarded-Forは偽装できるので使わない
+func remoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,177 @@
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sns-login/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDb, err := db.DB(); err == nil {
+			_ = sqlDb.Close()
+		}
+	})
+	if err := db.AutoMigrate(&model.Session{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewStore(db)
+}
+
+// createSession はセッションを作成し、そのcookieを付けたリクエストを返す
+func createSession(t *testing.T, s *Store, r *http.Request) *http.Request {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	if _, err := s.Create(w, r, 1); err != nil {
+		t.Fatal(err)
+	}
+	next := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		next.AddCookie(c)
+	}
+
+	return next
+}
+
+func TestStore_Create(t *testing.T) {
+	s := newTestStore(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	session, err := s.Create(w, r, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), session.UserId)
+	assert.Equal(t, "192.0.2.1", session.IpAddress)
+	assert.Equal(t, "test-agent", session.UserAgent)
+
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, CookieName, cookies[0].Name)
+	assert.True(t, cookies[0].Secure)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+	// DBにはセッションIDそのものを保存しない
+	assert.NotEqual(t, cookies[0].Value, session.IdHash)
+}
+
+func TestStore_Get(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		elapsed  time.Duration
+		lastSeen time.Duration
+		expected error
+	}{
+		{"有効", time.Minute, 0, nil},
+		{"アクセスがない期間が長い", DefaultIdleTimeout + time.Minute, 0, ErrSessionExpired},
+		{
+			"アクセスがあっても最大の期間を過ぎた",
+			DefaultAbsoluteTimeout + time.Minute,
+			DefaultAbsoluteTimeout,
+			ErrSessionExpired,
+		},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			s := newTestStore(t)
+			now := time.Now()
+			s.now = func() time.Time { return now }
+			r := createSession(t, s, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			// 最後にアクセスした時刻を進めておく
+			s.db.Model(&model.Session{}).Where("1 = 1").Update("last_seen_at", now.Add(pattern.lastSeen))
+			s.now = func() time.Time { return now.Add(pattern.elapsed) }
+
+			_, err := s.Get(r)
+			assert.ErrorIs(t, err, pattern.expected)
+		})
+	}
+}
+
+func TestStore_Get_NotFound(t *testing.T) {
+	s := newTestStore(t)
+
+	_, err := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: CookieName, Value: "unknown"})
+	_, err = s.Get(r)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestStore_Create_Rotation(t *testing.T) {
+	s := newTestStore(t)
+
+	// ログイン前のセッションIDを持ったままログインし直すと、古いセッションIDは使えなくなる
+	oldRequest := createSession(t, s, httptest.NewRequest(http.MethodGet, "/", nil))
+	newRequest := createSession(t, s, oldRequest)
+
+	_, err := s.Get(oldRequest)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	_, err = s.Get(newRequest)
+	assert.Nil(t, err)
+}
+
+func TestStore_Create_DeleteExpired(t *testing.T) {
+	patterns := []struct {
+		desc      string
+		elapsed   time.Duration
+		lastSeen  time.Duration
+		isDeleted bool
+	}{
+		{"有効", time.Minute, 0, false},
+		{"アクセスがない期間が長い", DefaultIdleTimeout + time.Minute, 0, true},
+		{"アクセスがあっても最大の期間を過ぎた", DefaultAbsoluteTimeout + time.Minute, DefaultAbsoluteTimeout, true},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			s := newTestStore(t)
+			now := time.Now()
+			s.now = func() time.Time { return now }
+			createSession(t, s, httptest.NewRequest(http.MethodGet, "/", nil))
+			s.db.Model(&model.Session{}).Where("1 = 1").Update("last_seen_at", now.Add(pattern.lastSeen))
+
+			// 別のブラウザからログインすると、Getされないままのセッションも期限が切れていれば削除される
+			s.now = func() time.Time { return now.Add(pattern.elapsed) }
+			createSession(t, s, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			var count int64
+			s.db.Unscoped().Model(&model.Session{}).Count(&count)
+			if pattern.isDeleted {
+				assert.Equal(t, int64(1), count)
+			} else {
+				assert.Equal(t, int64(2), count)
+			}
+		})
+	}
+}
+
+func TestStore_Destroy(t *testing.T) {
+	s := newTestStore(t)
+	r := createSession(t, s, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	assert.Nil(t, s.Destroy(w, r))
+	assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+
+	_, err := s.Get(r)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
@@ -0,0 +1,160 @@
+package session
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sns-login/model"
+	"sns-login/oidc"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// transactionCookiePrefix はログインの試行をブラウザと結びつけるcookieの名前の接頭辞。後ろにstateを付ける
+	transactionCookiePrefix = "auth_tx_"
+	// transactionCookiePath はIdPから戻ってくるパスにだけcookieを送るためのPath
+	transactionCookiePath = "/auth/"
+	// DefaultTransactionLifetime はIdPのログイン画面から戻ってくるまでに許容する時間
+	DefaultTransactionLifetime = 10 * time.Minute
+)
+
+var (
+	ErrTransactionNotFound = errors.New("auth transaction not found")
+	ErrTransactionExpired  = errors.New("auth transaction expired")
+)
+
+// TransactionStore はログインの試行ごとにstate, nonce, code_verifierなどをDBに保存する
+//
+// ブラウザにはstateごとのcookieで推測できない値だけを渡し、他のブラウザから使われないようにする
+type TransactionStore struct {
+	db       *gorm.DB
+	Lifetime time.Duration
+	// now は現在時刻を返す。テストで差し替える
+	now func() time.Time
+}
+
+func NewTransactionStore(db *gorm.DB) *TransactionStore {
+	return &TransactionStore{
+		db:       db,
+		Lifetime: DefaultTransactionLifetime,
+		now:      time.Now,
+	}
+}
+
+// Begin は新しいログインの試行を保存し、ブラウザと結びつけるcookieを書き込む
+//
+// IdPからPOSTで戻ってくる(form_post)場合はクロスサイトのリクエストになるので、sameSiteにhttp.SameSiteNoneModeを渡す
+func (s *TransactionStore) Begin(
+	w http.ResponseWriter,
+	provider string,
+	returnTo string,
+	sameSite http.SameSite,
+) (model.AuthTransaction, string, error) {
+	// 戻ってこなかったログインの試行が溜まらないように、期限切れのものを削除しておく
+	if err := s.db.Unscoped().Where("expires_at < ?", s.now()).Delete(&model.AuthTransaction{}).Error; err != nil {
+		return model.AuthTransaction{}, "", fmt.Errorf("failed to delete expired auth transactions: %w", err)
+	}
+
+	state, err := oidc.RandomState()
+	if err != nil {
+		return model.AuthTransaction{}, "", err
+	}
+	nonce, err := oidc.RandomNonce()
+	if err != nil {
+		return model.AuthTransaction{}, "", err
+	}
+	codeVerifier, err := oidc.RandomCodeVerifier()
+	if err != nil {
+		return model.AuthTransaction{}, "", err
+	}
+	binding, err := newSessionId()
+	if err != nil {
+		return model.AuthTransaction{}, "", err
+	}
+
+	tx := model.AuthTransaction{
+		StateHash:    hashSessionId(state),
+		BindingHash:  hashSessionId(binding),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		Provider:     provider,
+		ReturnTo:     returnTo,
+		ExpiresAt:    s.now().Add(s.Lifetime),
+	}
+	if err := s.db.Create(&tx).Error; err != nil {
+		return model.AuthTransaction{}, "", fmt.Errorf("failed to create auth transaction: %w", err)
+	}
+	http.SetCookie(w, transactionCookie(state, binding, int(s.Lifetime.Seconds()), sameSite))
+
+	return tx, state, nil
+}
+
+// Complete はIdPから戻ってきたstateに対応するログインの試行を返し、使い捨てにするため削除する
+//
+// stateを発行したブラウザのcookieがない場合や、別のIdPで発行したstateの場合はErrTransactionNotFoundを返す
+func (s *TransactionStore) Complete(
+	w http.ResponseWriter,
+	r *http.Request,
+	state string,
+	provider string,
+	sameSite http.SameSite,
+) (model.AuthTransaction, error) {
+	if state == "" {
+		return model.AuthTransaction{}, ErrTransactionNotFound
+	}
+	cookie, err := r.Cookie(transactionCookiePrefix + state)
+	if err != nil {
+		return model.AuthTransaction{}, ErrTransactionNotFound
+	}
+	http.SetCookie(w, transactionCookie(state, "", -1, sameSite))
+
+	var tx model.AuthTransaction
+	err = s.db.Where("state_hash = ?", hashSessionId(state)).First(&tx).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.AuthTransaction{}, ErrTransactionNotFound
+	}
+	if err != nil {
+		return model.AuthTransaction{}, fmt.Errorf("failed to find auth transaction: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(tx.BindingHash), []byte(hashSessionId(cookie.Value))) != 1 ||
+		tx.Provider != provider {
+		return model.AuthTransaction{}, ErrTransactionNotFound
+	}
+
+	// 検証に失敗しても同じstateでやり直せないように、期限を確認する前に削除する。
+	// 同じコールバックが同時に届いても1回しか使えないように、削除できたリクエストだけを通す
+	res := s.db.Unscoped().Where("state_hash = ?", tx.StateHash).Delete(&model.AuthTransaction{})
+	if res.Error != nil {
+		return model.AuthTransaction{}, fmt.Errorf("failed to delete auth transaction: %w", res.Error)
+	}
+	if res.RowsAffected != 1 {
+		return model.AuthTransaction{}, ErrTransactionNotFound
+	}
+	if s.now().After(tx.ExpiresAt) {
+		return model.AuthTransaction{}, ErrTransactionExpired
+	}
+
+	return tx, nil
+}
+
+// transactionCookie はログインの試行とブラウザを結びつけるcookieを返す。maxAgeが負の場合はcookieを削除する
+//
+// form_postで戻ってくるIdP以外は、リダイレクトで戻ってくるGETでも送られるLaxにする
+func transactionCookie(state string, value string, maxAge int, sameSite http.SameSite) *http.Cookie {
+	if sameSite != http.SameSiteNoneMode {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	return &http.Cookie{
+		Name:     transactionCookiePrefix + state,
+		Value:    value,
+		Path:     transactionCookiePath,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sns-login/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newTestTransactionStore(t *testing.T) *TransactionStore {
+	t.Helper()
+
+	db := newTestStore(t).db
+	if err := db.AutoMigrate(&model.AuthTransaction{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewTransactionStore(db)
+}
+
+// beginTransaction はログインの試行を保存し、stateとブラウザのcookieを返す
+func beginTransaction(t *testing.T, s *TransactionStore, provider string) (string, *http.Cookie) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	_, state, err := s.Begin(w, provider, "/mypage", http.SameSiteLaxMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state, w.Result().Cookies()[0]
+}
+
+func TestTransactionStore_Complete(t *testing.T) {
+	patterns := []struct {
+		desc     string
+		elapsed  time.Duration
+		provider string
+		isReplay bool
+		binding  string
+		expected error
+	}{
+		{"有効", time.Minute, "google", false, "", nil},
+		{"期限切れ", DefaultTransactionLifetime + time.Minute, "google", false, "", ErrTransactionExpired},
+		{"別のIdPのコールバック", time.Minute, "github", false, "", ErrTransactionNotFound},
+		{"使用済み", time.Minute, "google", true, "", ErrTransactionNotFound},
+		{"別のブラウザ", time.Minute, "google", false, "other", ErrTransactionNotFound},
+	}
+
+	for _, pattern := range patterns {
+		t.Run(pattern.desc, func(t *testing.T) {
+			s := newTestTransactionStore(t)
+			now := time.Now()
+			s.now = func() time.Time { return now }
+			state, cookie := beginTransaction(t, s, "google")
+			if pattern.binding != "" {
+				cookie.Value = pattern.binding
+			}
+			s.now = func() time.Time { return now.Add(pattern.elapsed) }
+
+			r := httptest.NewRequest(http.MethodGet, "/auth/google/callback", nil)
+			r.AddCookie(cookie)
+			if pattern.isReplay {
+				_, err := s.Complete(httptest.NewRecorder(), r, state, "google", http.SameSiteLaxMode)
+				assert.Nil(t, err)
+			}
+
+			w := httptest.NewRecorder()
+			tx, err := s.Complete(w, r, state, pattern.provider, http.SameSiteLaxMode)
+			assert.ErrorIs(t, err, pattern.expected)
+			if pattern.expected == nil {
+				assert.Equal(t, "/mypage", tx.ReturnTo)
+				// 使い終わったcookieは削除する
+				assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+			}
+		})
+	}
+}
+
+func TestTransactionStore_Concurrent(t *testing.T) {
+	s := newTestTransactionStore(t)
+
+	// 2つのタブでログインを始めても、どちらのタブからも戻ってこられる
+	firstState, firstCookie := beginTransaction(t, s, "google")
+	secondState, secondCookie := beginTransaction(t, s, "google")
+	assert.NotEqual(t, firstState, secondState)
+	assert.NotEqual(t, firstCookie.Name, secondCookie.Name)
+
+	r := httptest.NewRequest(http.MethodGet, "/auth/google/callback", nil)
+	r.AddCookie(firstCookie)
+	r.AddCookie(secondCookie)
+	_, err := s.Complete(httptest.NewRecorder(), r, secondState, "google", http.SameSiteLaxMode)
+	assert.Nil(t, err)
+	_, err = s.Complete(httptest.NewRecorder(), r, firstState, "google", http.SameSiteLaxMode)
+	assert.Nil(t, err)
+}
+
+func TestTransactionStore_CompleteReplay(t *testing.T) {
+	s := newTestTransactionStore(t)
+	state, cookie := beginTransaction(t, s, "google")
+	complete := func() error {
+		r := httptest.NewRequest(http.MethodGet, "/auth/google/callback", nil)
+		r.AddCookie(cookie)
+		_, err := s.Complete(httptest.NewRecorder(), r, state, "google", http.SameSiteLaxMode)
+
+		return err
+	}
+
+	// 1回目のリクエストがstateを読んでから削除するまでの間に、同じコールバックがもう一度届く
+	var replayErr error
+	var replayed bool
+	err := s.db.Callback().Query().After("gorm:query").Register("test:replay", func(db *gorm.DB) {
+		if replayed || db.Statement.Table != "auth_transactions" {
+			return
+		}
+		replayed = true
+		replayErr = complete()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 成功するのはどちらか1回だけ
+	err = complete()
+	assert.True(t, replayed)
+	assert.Nil(t, replayErr)
+	assert.ErrorIs(t, err, ErrTransactionNotFound)
+}